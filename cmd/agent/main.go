@@ -1,15 +1,20 @@
 package main
 
 import (
+	"crypto/rsa"
 	"fmt"
 	"log"
 
+	"go.uber.org/zap"
+
 	"metrics/internal/agent/adapters/storage"
 	"metrics/internal/agent/adapters/storage/memory"
 	"metrics/internal/agent/adapters/workers"
 	"metrics/internal/agent/config"
+	"metrics/internal/agent/core/handlers"
 	"metrics/internal/agent/core/service"
 	"metrics/internal/agent/logger"
+	"metrics/internal/shared-kernel/encryption"
 )
 
 func main() {
@@ -38,7 +43,37 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("failed to initialize a storage: %w", err)
 	}
-	agentMetricService := service.NewAgentMetricService(gaugeAgentStorage, counterAgentStorage)
+	var publicKey *rsa.PublicKey
+	if cfg.CryptoKey != "" {
+		publicKey, err = encryption.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			return fmt.Errorf("failed to load public key: %w", err)
+		}
+	}
+	var sender service.MetricSender
+	switch cfg.Transport {
+	case config.TransportHTTP:
+		sender = handlers.NewClient(cfg, publicKey)
+	case config.TransportGRPC:
+		grpcClient, err := handlers.NewGRPCClient(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialize a grpc client: %w", err)
+		}
+		defer func() {
+			if err := grpcClient.Close(); err != nil {
+				logger.Log.Error("failed to close grpc client", zap.Error(err))
+			}
+		}()
+		sender = grpcClient
+	default:
+		return fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+	agentMetricService := service.NewAgentMetricService(
+		gaugeAgentStorage,
+		counterAgentStorage,
+		sender,
+		cfg,
+	)
 	worker := workers.NewAgentWorker(agentMetricService, cfg)
 	if err = worker.Run(); err != nil {
 		return fmt.Errorf("server has failed: %w", err)
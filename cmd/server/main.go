@@ -1,18 +1,30 @@
 package main
 
 import (
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"go.uber.org/zap"
+
+	"metrics/internal/server/adapters/api/graphite"
 	"metrics/internal/server/adapters/api/rest"
+	"metrics/internal/server/adapters/api/rpc"
+	"metrics/internal/server/adapters/api/statsd"
+	"metrics/internal/server/adapters/notify/webhook"
 	"metrics/internal/server/adapters/storage"
 	"metrics/internal/server/adapters/storage/file"
 	"metrics/internal/server/adapters/storage/memory"
 	"metrics/internal/server/config"
+	"metrics/internal/server/core/alerting"
+	"metrics/internal/server/core/domain"
 	"metrics/internal/server/core/service"
 	"metrics/internal/server/logger"
+	"metrics/internal/shared-kernel/encryption"
 )
 
 func main() {
@@ -37,8 +49,78 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("failed to initialize a service: %w", err)
 	}
-	api := rest.NewAPI(metricService, cfg)
-	if err = api.Run(); err != nil {
+	var privateKey *rsa.PrivateKey
+	if cfg.CryptoKey != "" {
+		privateKey, err = encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			return fmt.Errorf("failed to load private key: %w", err)
+		}
+	}
+	alerts, err := initAlerting(cfg, metricService)
+	if err != nil {
+		return fmt.Errorf("failed to initialize alerting: %w", err)
+	}
+	alerts.Start()
+	api, err := rest.NewAPI(metricService, alerts, cfg, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to initialize an api: %w", err)
+	}
+	var grpcServer *rpc.Server
+	if cfg.GRPCAddress != "" {
+		grpcServer, err = rpc.NewServer(metricService, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialize a grpc server: %w", err)
+		}
+		go func() {
+			if err := grpcServer.Run(); err != nil {
+				logger.Log.Error("grpc server has failed", zap.Error(err))
+			}
+		}()
+		logger.Log.Info("grpc server is running", zap.String("address", cfg.GRPCAddress))
+	}
+	var statsdListener *statsd.Listener
+	if cfg.StatsdAddress != "" {
+		statsdListener, err = statsd.NewListener(metricService, cfg.StatsdAddress)
+		if err != nil {
+			return fmt.Errorf("failed to initialize a statsd listener: %w", err)
+		}
+		go func() {
+			if err := statsdListener.Run(); err != nil {
+				logger.Log.Error("statsd listener has failed", zap.Error(err))
+			}
+		}()
+		logger.Log.Info("statsd listener is running", zap.String("address", cfg.StatsdAddress))
+	}
+	var graphiteListener *graphite.Listener
+	if cfg.GraphiteAddress != "" {
+		var counterPatterns []string
+		if cfg.GraphiteCounters != "" {
+			counterPatterns = strings.Split(cfg.GraphiteCounters, ",")
+		}
+		graphiteListener, err = graphite.NewListener(metricService, cfg.GraphiteAddress, counterPatterns)
+		if err != nil {
+			return fmt.Errorf("failed to initialize a graphite listener: %w", err)
+		}
+		go func() {
+			if err := graphiteListener.Run(); err != nil {
+				logger.Log.Error("graphite listener has failed", zap.Error(err))
+			}
+		}()
+		logger.Log.Info("graphite listener is running", zap.String("address", cfg.GraphiteAddress))
+	}
+	err = api.Run()
+	alerts.Stop()
+	metricService.Stop()
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
+	if statsdListener != nil {
+		statsdListener.Stop()
+	}
+	if graphiteListener != nil {
+		graphiteListener.Stop()
+	}
+	if err != nil {
 		if errors.Is(err, http.ErrServerClosed) {
 			err = metricService.SaveMetricsToFile()
 			if err != nil {
@@ -53,10 +135,44 @@ func run() error {
 	return nil
 }
 
+// initAlerting загружает правила алертинга. Без файла правил движок создаётся пустым и ничего не проверяет.
+func initAlerting(cfg *config.Config, metricService *service.MetricService) (*alerting.Engine, error) {
+	var rules []domain.AlertRule
+	if cfg.AlertRules != "" {
+		if cfg.AlertInterval <= 0 {
+			return nil, errors.New("alert interval must be positive")
+		}
+		var err error
+		rules, err = alerting.LoadRules(cfg.AlertRules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load alert rules: %w", err)
+		}
+		logger.Log.Info("alert rules loaded", zap.Int("rules", len(rules)))
+	}
+	var notifier alerting.Notifier
+	if cfg.AlertWebhook != "" {
+		notifier = webhook.NewSender(cfg.AlertWebhook)
+	}
+	return alerting.NewEngine(rules, metricService, notifier, time.Duration(cfg.AlertInterval)*time.Second), nil
+}
+
 func initMetricStorage(cfg *config.Config) (storage.MetricStorage, error) {
+	retention := cfg.Retention()
+	rules, err := domain.ParseTTLRules(cfg.StaleTTLs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stale ttls: %w", err)
+	}
+	staleness := domain.Staleness{
+		TTL:   time.Duration(cfg.StaleTTL) * time.Second,
+		Rules: rules,
+		Evict: time.Duration(cfg.EvictTTL) * time.Second,
+	}
 	if cfg.FileStoragePath == "" {
 		metricStorage, err := storage.NewStorage(storage.Config{
-			Memory: &memory.Config{},
+			Memory: &memory.Config{
+				Retention: retention,
+				Staleness: staleness,
+			},
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to init memory storage %w", err)
@@ -68,6 +184,8 @@ func initMetricStorage(cfg *config.Config) (storage.MetricStorage, error) {
 			File: &file.Config{
 				Filepath:      cfg.FileStoragePath,
 				StoreInterval: cfg.StoreInterval,
+				Retention:     retention,
+				Staleness:     staleness,
 			},
 		})
 		if err != nil {
@@ -2,7 +2,6 @@ package workers
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -14,7 +13,7 @@ import (
 
 type AgentMetricService interface {
 	UpdateMetrics(pollCount int) error
-	SendMetrics(host string) error
+	SendMetrics() error
 }
 
 type AgentWorker struct {
@@ -30,12 +29,6 @@ func NewAgentWorker(agentMetricService AgentMetricService, cfg *config.Config) *
 }
 
 func (a *AgentWorker) Run() error {
-	address := strings.Split(a.config.Address, ":")
-	port := "8080"
-	if len(address) > 1 {
-		port = address[1]
-	}
-	host := "http://localhost:" + port
 	updateMetricsTicker := time.NewTicker(time.Duration(a.config.PollInterval) * time.Second)
 	sendMetricsTicker := time.NewTicker(time.Duration(a.config.ReportInterval) * time.Second)
 	pollCount := 0
@@ -48,7 +41,7 @@ func (a *AgentWorker) Run() error {
 				return fmt.Errorf("failed to update metrics %w", err)
 			}
 		case <-sendMetricsTicker.C:
-			err := a.agentMetricService.SendMetrics(host)
+			err := a.agentMetricService.SendMetrics()
 			if err != nil {
 				logger.Log.Error("failed to send metrics", zap.Error(err))
 			}
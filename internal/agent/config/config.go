@@ -10,20 +10,39 @@ import (
 const (
 	defaultPollInterval   = 2
 	defaultReportInterval = 10
+	defaultBatchSize      = 100
+	defaultRequestTimeout = 5
+)
+
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
 )
 
 type Config struct {
 	Address        string `env:"ADDRESS"`
+	GRPCAddress    string `env:"GRPC_ADDRESS"`
+	Transport      string `env:"TRANSPORT"`
+	RequestTimeout int    `env:"REQUEST_TIMEOUT"`
 	ReportInterval int    `env:"REPORT_INTERVAL"`
 	PollInterval   int    `env:"POLL_INTERVAL"`
+	BatchSize      int    `env:"BATCH_SIZE"`
+	Key            string `env:"KEY"`
+	CryptoKey      string `env:"CRYPTO_KEY"`
 	LogLevel       string
 }
 
 func NewConfig() (*Config, error) {
 	var cfg Config
 	flag.StringVar(&cfg.Address, "a", "localhost:8080", "run address")
+	flag.StringVar(&cfg.GRPCAddress, "g", "localhost:3200", "grpc server address")
+	flag.StringVar(&cfg.Transport, "transport", TransportHTTP, "transport to report metrics: http or grpc")
+	flag.IntVar(&cfg.RequestTimeout, "timeout", defaultRequestTimeout, "deadline (seconds) for a single report request")
 	flag.IntVar(&cfg.PollInterval, "p", defaultPollInterval, " poll interval ")
 	flag.IntVar(&cfg.ReportInterval, "r", defaultReportInterval, " report interval ")
+	flag.IntVar(&cfg.BatchSize, "b", defaultBatchSize, "max metrics per batch request, 0 - no limit")
+	flag.StringVar(&cfg.Key, "k", "", "key to sign requests with HMAC-SHA256")
+	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "path to server public key PEM to encrypt requests")
 	flag.StringVar(&cfg.LogLevel, "l", "info", "log level")
 	flag.Parse()
 	err := env.Parse(&cfg)
@@ -1,5 +1,7 @@
 package domain
 
+import "errors"
+
 const (
 	Gauge       = "gauge"
 	Counter     = "counter"
@@ -7,6 +9,8 @@ const (
 	RandomValue = "RandomValue"
 )
 
+var ErrNotFound = errors.New("route not found")
+
 type Metrics struct {
 	Values map[string]string
 }
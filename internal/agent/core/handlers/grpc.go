@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"metrics/internal/agent/config"
+	"metrics/internal/agent/core/domain"
+	"metrics/internal/agent/logger"
+	"metrics/internal/shared-kernel/hash"
+	"metrics/internal/shared-kernel/pb"
+)
+
+type GRPCClient struct {
+	conn    *grpc.ClientConn
+	client  pb.MetricsClient
+	realIP  string
+	key     string
+	timeout time.Duration
+}
+
+func NewGRPCClient(cfg *config.Config) (*GRPCClient, error) {
+	conn, err := grpc.NewClient(
+		cfg.GRPCAddress,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	return &GRPCClient{
+		conn:    conn,
+		client:  pb.NewMetricsClient(conn),
+		realIP:  realIP(cfg.GRPCAddress),
+		key:     cfg.Key,
+		timeout: time.Duration(cfg.RequestTimeout) * time.Second,
+	}, nil
+}
+
+func (c *GRPCClient) Close() error {
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("failed to close grpc connection: %w", err)
+	}
+	return nil
+}
+
+func (c *GRPCClient) SendMetrics(request *domain.MetricRequestJSON) error {
+	req := &pb.SetMetricRequest{Metric: toProto(request)}
+	ctx, cancel, err := c.callContext(req)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	start := time.Now()
+	_, err = c.client.SetMetric(ctx, req)
+	c.logCall(pb.Metrics_SetMetric_FullMethodName, start, err)
+	return c.handleError(err)
+}
+
+func (c *GRPCClient) SendMetricsBatch(requests []domain.MetricRequestJSON) error {
+	metrics := make([]*pb.Metric, 0, len(requests))
+	for i := range requests {
+		metrics = append(metrics, toProto(&requests[i]))
+	}
+	req := &pb.SetMetricsRequest{Metrics: metrics}
+	ctx, cancel, err := c.callContext(req)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	start := time.Now()
+	_, err = c.client.SetMetrics(ctx, req)
+	c.logCall(pb.Metrics_SetMetrics_FullMethodName, start, err)
+	return c.handleError(err)
+}
+
+// callContext добавляет в метаданные адрес агента и, если задан ключ, подпись запроса.
+func (c *GRPCClient) callContext(req proto.Message) (context.Context, context.CancelFunc, error) {
+	ctx := context.Background()
+	if c.realIP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-real-ip", c.realIP)
+	}
+	if c.key != "" {
+		signature, err := hash.SignMessage(c.key, req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, hash.MetadataKey, signature)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	return ctx, cancel, nil
+}
+
+func (c *GRPCClient) logCall(method string, start time.Time, err error) {
+	logger.Log.Info(
+		"made grpc request",
+		zap.String("method", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
+
+func (c *GRPCClient) handleError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) == codes.Unimplemented {
+		return fmt.Errorf("%w: %w", domain.ErrNotFound, err)
+	}
+	return fmt.Errorf("failed to send metrics: %w", err)
+}
+
+func toProto(m *domain.MetricRequestJSON) *pb.Metric {
+	return &pb.Metric{
+		Id:    m.ID,
+		Type:  m.MType,
+		Delta: m.Delta,
+		Value: m.Value,
+	}
+}
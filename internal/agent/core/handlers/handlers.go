@@ -1,21 +1,61 @@
 package handlers
 
 import (
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 
 	"metrics/internal/shared-kernel/compress"
+	"metrics/internal/shared-kernel/encryption"
+	"metrics/internal/shared-kernel/hash"
 
+	"metrics/internal/agent/config"
 	"metrics/internal/agent/core/domain"
 	"metrics/internal/agent/logger"
 )
 
-func SendMetrics(host string, request *domain.MetricRequestJSON) error {
-	data, err := json.Marshal(request)
+type Client struct {
+	client    *resty.Client
+	host      string
+	realIP    string
+	key       string
+	publicKey *rsa.PublicKey
+}
+
+func NewClient(cfg *config.Config, publicKey *rsa.PublicKey) *Client {
+	host, port, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		host, port = cfg.Address, "8080"
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	address := net.JoinHostPort(host, port)
+	return &Client{
+		client:    resty.New().SetTimeout(time.Duration(cfg.RequestTimeout) * time.Second),
+		host:      "http://" + address,
+		realIP:    realIP(address),
+		key:       cfg.Key,
+		publicKey: publicKey,
+	}
+}
+
+func (c *Client) SendMetrics(request *domain.MetricRequestJSON) error {
+	return c.post(c.host+"/update/", request)
+}
+
+func (c *Client) SendMetricsBatch(requests []domain.MetricRequestJSON) error {
+	return c.post(c.host+"/updates/", requests)
+}
+
+func (c *Client) post(endpoint string, body any) error {
+	data, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to parse model: %w", err)
 	}
@@ -23,19 +63,29 @@ func SendMetrics(host string, request *domain.MetricRequestJSON) error {
 	if err != nil {
 		return fmt.Errorf("failed to gzip metrics: %w", err)
 	}
-	client := resty.New()
-	resp, err := client.R().
+	req := c.client.R()
+	if c.realIP != "" {
+		req.SetHeader("X-Real-IP", c.realIP)
+	}
+	if c.key != "" {
+		req.SetHeader(hash.Header, hash.Sign(c.key, data))
+	}
+	if c.publicKey != nil {
+		buf, err = encryption.Seal(c.publicKey, buf)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt metrics: %w", err)
+		}
+		req.SetHeader(encryption.Header, encryption.Scheme)
+	}
+	resp, err := req.
 		SetHeader("Content-Type", `application/json`).
 		SetHeader("Content-Encoding", `gzip`).
 		SetHeader("Accept-Encoding", `gzip`).
 		SetBody(buf).
-		Post(host + "/update/")
+		Post(endpoint)
 	if err != nil {
 		return fmt.Errorf("failed to send metrics: %w", err)
 	}
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("bad request. Status Code %d", resp.StatusCode())
-	}
 	logger.Log.Info(
 		"made http request",
 		zap.String("uri", resp.Request.URL),
@@ -43,5 +93,42 @@ func SendMetrics(host string, request *domain.MetricRequestJSON) error {
 		zap.Int("statusCode", resp.StatusCode()),
 		zap.Duration("duration", resp.Time()),
 	)
-	return nil
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", domain.ErrNotFound, endpoint)
+	default:
+		return fmt.Errorf("bad request. Status Code %d", resp.StatusCode())
+	}
+}
+
+// realIP определяет адрес агента для X-Real-IP один раз при создании клиента.
+// Если адрес определить не удалось, заголовок не передаётся.
+func realIP(address string) string {
+	ip, err := outboundIP(address)
+	if err != nil {
+		logger.Log.Info("cannot detect outbound address", zap.Error(err))
+		return ""
+	}
+	return ip.String()
+}
+
+// outboundIP возвращает адрес интерфейса, через который уходят пакеты к серверу host:port.
+// UDP-сокет ничего не отправляет, он нужен только чтобы ОС выбрала маршрут.
+func outboundIP(host string) (net.IP, error) {
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", host, err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logger.Log.Error("failed to close connection", zap.Error(err))
+		}
+	}()
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("unexpected local address %s", conn.LocalAddr())
+	}
+	return addr.IP, nil
 }
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/agent/config"
+	"metrics/internal/agent/core/domain"
+)
+
+// X-Real-IP совпадает с адресом интерфейса, с которого агент подключается к серверу, а не с loopback.
+func TestClient_RealIP(t *testing.T) {
+	ip := nonLoopbackIP(t)
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", ip, err)
+	}
+	var realIP, remoteIP string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realIP = r.Header.Get("X-Real-IP")
+		remoteIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}))
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	client := NewClient(&config.Config{Address: listener.Addr().String(), RequestTimeout: 1}, nil)
+	value := 1.5
+	assert.NoError(t, client.SendMetrics(&domain.MetricRequestJSON{ID: "Alloc", MType: "gauge", Value: &value}))
+	assert.Equal(t, ip.String(), realIP)
+	assert.Equal(t, remoteIP, realIP)
+}
+
+func nonLoopbackIP(t *testing.T) net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Skipf("cannot list interfaces: %v", err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP
+		}
+	}
+	t.Skip("no non-loopback interface")
+	return nil
+}
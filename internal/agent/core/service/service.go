@@ -7,8 +7,9 @@ import (
 	"runtime"
 	"strconv"
 
+	"metrics/internal/agent/config"
 	"metrics/internal/agent/core/domain"
-	"metrics/internal/agent/core/handlers"
+	"metrics/internal/agent/logger"
 )
 
 type AgentMetricStorage interface {
@@ -17,18 +18,29 @@ type AgentMetricStorage interface {
 	GetAllMetrics(request *domain.GetAllMetricsRequest) *domain.GetAllMetricsResponse
 }
 
+type MetricSender interface {
+	SendMetrics(request *domain.MetricRequestJSON) error
+	SendMetricsBatch(requests []domain.MetricRequestJSON) error
+}
+
 type AgentMetricService struct {
 	gaugeAgentStorage   AgentMetricStorage
 	counterAgentStorage AgentMetricStorage
+	sender              MetricSender
+	batchSize           int
 }
 
 func NewAgentMetricService(
 	gaugeAgentStorage AgentMetricStorage,
 	counterAgentStorage AgentMetricStorage,
+	sender MetricSender,
+	cfg *config.Config,
 ) *AgentMetricService {
 	return &AgentMetricService{
 		gaugeAgentStorage:   gaugeAgentStorage,
 		counterAgentStorage: counterAgentStorage,
+		sender:              sender,
+		batchSize:           cfg.BatchSize,
 	}
 }
 
@@ -113,45 +125,72 @@ func (a *AgentMetricService) getAllMetrics(request *domain.GetAllMetricsRequest)
 	}
 }
 
-func (a *AgentMetricService) SendMetrics(host string) error {
+func (a *AgentMetricService) collectReport() ([]domain.MetricRequestJSON, error) {
 	response := a.getAllMetrics(&domain.GetAllMetricsRequest{
 		MetricType: domain.Gauge,
 	})
+	if response.Error != nil {
+		return nil, fmt.Errorf("error occured geting metrics: %w", response.Error)
+	}
+	report := make([]domain.MetricRequestJSON, 0, len(response.Values)+1)
 	for metricName, metricValue := range response.Values {
 		gaugeValue, err := strconv.ParseFloat(metricValue, 64)
 		if err != nil {
-			return fmt.Errorf("error occured during parsing metrics: %w", err)
+			return nil, fmt.Errorf("error occured during parsing metrics: %w", err)
 		}
-		request := domain.MetricRequestJSON{
+		report = append(report, domain.MetricRequestJSON{
 			ID:    metricName,
 			MType: domain.Gauge,
 			Value: &gaugeValue,
-		}
-		err = handlers.SendMetrics(host, &request)
-		if err != nil {
-			return fmt.Errorf("error occured during sending metrics: %w", err)
-		}
+		})
 	}
 	response = a.getAllMetrics(&domain.GetAllMetricsRequest{
 		MetricType: domain.Counter,
 	})
 	if response.Error != nil {
-		return fmt.Errorf("error occured geting metrics: %w", response.Error)
+		return nil, fmt.Errorf("error occured geting metrics: %w", response.Error)
 	}
 	for metricName, metricValue := range response.Values {
-		counterValue, err := strconv.Atoi(metricValue)
-		counterInt64Value := int64(counterValue)
+		counterValue, err := strconv.ParseInt(metricValue, 10, 64)
 		if err != nil {
-			return fmt.Errorf("error occured during parsing metrics: %w", err)
+			return nil, fmt.Errorf("error occured during parsing metrics: %w", err)
 		}
-		request := domain.MetricRequestJSON{
+		report = append(report, domain.MetricRequestJSON{
 			ID:    metricName,
 			MType: domain.Counter,
-			Delta: &counterInt64Value,
+			Delta: &counterValue,
+		})
+	}
+	return report, nil
+}
+
+func (a *AgentMetricService) SendMetrics() error {
+	report, err := a.collectReport()
+	if err != nil {
+		return err
+	}
+	batchSize := a.batchSize
+	if batchSize <= 0 {
+		batchSize = len(report)
+	}
+	batchSupported := true
+	for start := 0; start < len(report); start += batchSize {
+		batch := report[start:min(start+batchSize, len(report))]
+		if batchSupported {
+			err = a.sender.SendMetricsBatch(batch)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, domain.ErrNotFound) {
+				return fmt.Errorf("error occured during sending metrics: %w", err)
+			}
+			logger.Log.Info("batch route is not supported, falling back to single updates")
+			batchSupported = false
 		}
-		err = handlers.SendMetrics(host, &request)
-		if err != nil {
-			return fmt.Errorf("error occured during sending metrics: %w", err)
+		for i := range batch {
+			if err = a.sender.SendMetrics(&batch[i]); err != nil {
+				return fmt.Errorf("error occured during sending metrics: %w", err)
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,193 @@
+package graphite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const idleTimeout = 5 * time.Minute
+
+var ErrMalformedLine = errors.New("malformed graphite line")
+
+type MetricService interface {
+	SetMetric(m *domain.Metric) (*domain.Metric, error)
+}
+
+type Listener struct {
+	metricService   MetricService
+	listener        net.Listener
+	counterPatterns [][]string
+	mux             *sync.Mutex
+	conns           map[net.Conn]struct{}
+	closed          bool
+	wg              *sync.WaitGroup
+}
+
+// NewListener слушает plaintext-протокол Graphite. Пути, подходящие под один из
+// counterPatterns, сохраняются как counter, остальные как gauge. Шаблон и путь сравниваются
+// по сегментам между точками, каждый сегмент - в синтаксисе path.Match, так что * не переходит через точку.
+func NewListener(metricService MetricService, address string, counterPatterns []string) (*Listener, error) {
+	patterns := make([][]string, 0, len(counterPatterns))
+	for _, pattern := range counterPatterns {
+		segments := strings.Split(pattern, ".")
+		for _, segment := range segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("bad counter pattern %q: %w", pattern, err)
+			}
+		}
+		patterns = append(patterns, segments)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen graphite address: %w", err)
+	}
+	return &Listener{
+		metricService:   metricService,
+		listener:        listener,
+		counterPatterns: patterns,
+		mux:             &sync.Mutex{},
+		conns:           make(map[net.Conn]struct{}),
+		wg:              &sync.WaitGroup{},
+	}, nil
+}
+
+func (l *Listener) Run() error {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept graphite connection: %w", err)
+		}
+		l.mux.Lock()
+		if l.closed {
+			l.mux.Unlock()
+			if err = conn.Close(); err != nil {
+				logger.Log.Error("failed to close graphite connection", zap.Error(err))
+			}
+			return nil
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mux.Unlock()
+		go l.serve(conn)
+	}
+}
+
+// Stop перестаёт принимать соединения, закрывает открытые и ждёт их обработчики.
+func (l *Listener) Stop() {
+	if err := l.listener.Close(); err != nil {
+		logger.Log.Error("failed to close graphite listener", zap.Error(err))
+	}
+	l.mux.Lock()
+	l.closed = true
+	for conn := range l.conns {
+		if err := conn.Close(); err != nil {
+			logger.Log.Error("failed to close graphite connection", zap.Error(err))
+		}
+	}
+	l.mux.Unlock()
+	l.wg.Wait()
+}
+
+func (l *Listener) serve(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mux.Lock()
+		delete(l.conns, conn)
+		l.mux.Unlock()
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Log.Error("failed to close graphite connection", zap.Error(err))
+		}
+	}()
+	address := conn.RemoteAddr().String()
+	scanner := bufio.NewScanner(conn)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(idleTimeout)); err != nil {
+			logger.Log.Error("failed to set read deadline", zap.Error(err))
+			return
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := l.handleLine(line, domain.NewSource(address, "")); err != nil {
+			logger.Log.Info("skip graphite line", zap.String("line", line), zap.Error(err))
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Log.Info("graphite connection closed", zap.Error(err))
+	}
+}
+
+func (l *Listener) isCounter(metricPath string) bool {
+	segments := strings.Split(metricPath, ".")
+	for _, pattern := range l.counterPatterns {
+		if matchSegments(pattern, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i := range pattern {
+		if matched, _ := path.Match(pattern[i], segments[i]); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLine разбирает строку "path value timestamp". Timestamp проверяется, но не используется:
+// хранилище держит только последнее значение.
+func (l *Listener) parseLine(line string) (domain.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return domain.Metric{}, fmt.Errorf("%w: expected path, value and timestamp", ErrMalformedLine)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return domain.Metric{}, fmt.Errorf("%w: bad value %q", ErrMalformedLine, fields[1])
+	}
+	if _, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return domain.Metric{}, fmt.Errorf("%w: bad timestamp %q", ErrMalformedLine, fields[2])
+	}
+	if l.isCounter(fields[0]) {
+		delta := int64(math.Round(value))
+		return domain.Metric{ID: fields[0], MType: domain.Counter, Delta: &delta}, nil
+	}
+	return domain.Metric{ID: fields[0], MType: domain.Gauge, Value: &value}, nil
+}
+
+func (l *Listener) handleLine(line string, source *domain.Source) error {
+	m, err := l.parseLine(line)
+	if err != nil {
+		return err
+	}
+	m.Source = source
+	if _, err = l.metricService.SetMetric(&m); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package graphite
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+)
+
+func TestListener_ParseLine(t *testing.T) {
+	l, err := NewListener(nil, "127.0.0.1:0", []string{"*.requests", "hits", "servers.*.requests"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer l.Stop()
+	gauge, delta, nested := 21.5, int64(4), 4.0
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    domain.Metric
+		wantErr bool
+	}{
+		{
+			name: "gauge",
+			raw:  "kitchen.temperature 21.5 1700000000",
+			want: domain.Metric{ID: "kitchen.temperature", MType: domain.Gauge, Value: &gauge},
+		},
+		{
+			name: "counterPattern",
+			raw:  "web.requests 3.6 1700000000",
+			want: domain.Metric{ID: "web.requests", MType: domain.Counter, Delta: &delta},
+		},
+		{
+			name: "counterExact",
+			raw:  "hits 4 1700000000.5",
+			want: domain.Metric{ID: "hits", MType: domain.Counter, Delta: &delta},
+		},
+		{
+			name: "multiSegmentCounter",
+			raw:  "servers.a.requests 4 1700000000",
+			want: domain.Metric{ID: "servers.a.requests", MType: domain.Counter, Delta: &delta},
+		},
+		{
+			// Звёздочка покрывает ровно один сегмент пути.
+			name: "deeperPathIsGauge",
+			raw:  "servers.a.b.c.requests 4 1700000000",
+			want: domain.Metric{ID: "servers.a.b.c.requests", MType: domain.Gauge, Value: &nested},
+		},
+		{
+			name: "nestedPathIsGauge",
+			raw:  "api.web.requests 4 1700000000",
+			want: domain.Metric{ID: "api.web.requests", MType: domain.Gauge, Value: &nested},
+		},
+		{name: "noTimestamp", raw: "hits 4", wantErr: true},
+		{name: "extraField", raw: "hits 4 1700000000 x", wantErr: true},
+		{name: "badValue", raw: "hits four 1700000000", wantErr: true},
+		{name: "infValue", raw: "hits +Inf 1700000000", wantErr: true},
+		{name: "nanValue", raw: "hits NaN 1700000000", wantErr: true},
+		{name: "badTimestamp", raw: "hits 4 yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.parseLine(tt.raw)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrMalformedLine)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewListener_BadPattern(t *testing.T) {
+	_, err := NewListener(nil, "127.0.0.1:0", []string{"[a-"})
+	assert.Error(t, err)
+}
+
+func TestListener_Stop(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	l, err := NewListener(metricService, "127.0.0.1:0", []string{"*.requests"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Run()
+	}()
+
+	conn, err := net.Dial("tcp", l.listener.Addr().String())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+	_, err = fmt.Fprint(conn, "web.requests 2 1700000000\nbroken line\nweb.load 0.5 1700000000\n")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := metricService.GetMetric(domain.Key{MType: domain.Gauge, ID: "web.load"})
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	value, err := metricService.GetMetricValue(domain.Key{MType: domain.Counter, ID: "web.requests"})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", value)
+
+	// Stop закрывает открытое соединение и слушатель, Run завершается без ошибки.
+	l.Stop()
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("Run did not return after Stop")
+	}
+	_, err = net.Dial("tcp", l.listener.Addr().String())
+	assert.Error(t, err)
+}
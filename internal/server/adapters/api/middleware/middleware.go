@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"bytes"
 	"compress/gzip"
+	"crypto/rsa"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -12,6 +15,8 @@ import (
 
 	"metrics/internal/server/logger"
 	"metrics/internal/shared-kernel/compress"
+	"metrics/internal/shared-kernel/encryption"
+	"metrics/internal/shared-kernel/hash"
 )
 
 type responseData struct {
@@ -38,6 +43,10 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func LoggingRequestMiddleware(h http.Handler) http.Handler {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -65,6 +74,62 @@ func LoggingRequestMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(logFn)
 }
 
+// DecryptRequestMiddleware расшифровывает тело запроса, если агент зашифровал его публичным ключом сервера.
+// Должен стоять перед CompressRequestMiddleware: агент шифрует уже сжатые данные.
+func DecryptRequestMiddleware(key *rsa.PrivateKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(encryption.Header)
+			if scheme == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if key == nil || scheme != encryption.Scheme {
+				http.Error(w, "unsupported encryption", http.StatusBadRequest)
+				return
+			}
+			envelope, err := io.ReadAll(r.Body)
+			if err != nil {
+				logger.Log.Error("cannot read body", zap.Error(err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			data, err := encryption.Open(key, envelope)
+			if err != nil {
+				logger.Log.Info("cannot decrypt request body", zap.Error(err))
+				http.Error(w, "cannot decrypt request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			r.ContentLength = int64(len(data))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TrustedSubnetMiddleware пропускает только запросы, у которых X-Real-IP входит в подсеть.
+// Пустая подсеть отключает проверку.
+func TrustedSubnetMiddleware(subnet *net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subnet == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip := net.ParseIP(r.Header.Get("X-Real-IP"))
+			if ip == nil || !subnet.Contains(ip) {
+				logger.Log.Info("request from untrusted address",
+					zap.String("X-Real-IP", r.Header.Get("X-Real-IP")),
+					zap.String("uri", r.RequestURI),
+				)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func CompressRequestMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
@@ -110,3 +175,92 @@ func CompressResponseMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(cw, r)
 	})
 }
+
+type signingResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (s *signingResponseWriter) Write(b []byte) (int, error) {
+	if s.streaming {
+		n, err := s.ResponseWriter.Write(b)
+		if err != nil {
+			return n, fmt.Errorf("failed to write response %w", err)
+		}
+		return n, nil
+	}
+	n, err := s.body.Write(b)
+	if err != nil {
+		return n, fmt.Errorf("failed to buffer response %w", err)
+	}
+	return n, nil
+}
+
+func (s *signingResponseWriter) WriteHeader(statusCode int) {
+	s.status = statusCode
+}
+
+// Flush переводит ответ в потоковый режим: тело бесконечного ответа нельзя подписать целиком,
+// поэтому накопленные данные отправляются без подписи, а дальнейшая запись идёт напрямую.
+func (s *signingResponseWriter) Flush() {
+	if !s.streaming {
+		s.streaming = true
+		s.ResponseWriter.WriteHeader(s.status)
+		if _, err := s.ResponseWriter.Write(s.body.Bytes()); err != nil {
+			logger.Log.Error("failed to write response", zap.Error(err))
+			return
+		}
+		s.body.Reset()
+	}
+	if err := http.NewResponseController(s.ResponseWriter).Flush(); err != nil {
+		logger.Log.Error("failed to flush response", zap.Error(err))
+	}
+}
+
+func (s *signingResponseWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// SignMiddleware проверяет подпись HMAC-SHA256 тела запроса и подписывает ответ.
+// Должен стоять после CompressRequestMiddleware, чтобы подпись считалась по распакованным данным.
+func SignMiddleware(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			signature := r.Header.Get(hash.Header)
+			readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+			if signature != "" || !readOnly {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					logger.Log.Error("cannot read body", zap.Error(err))
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				if !hash.Verify(key, body, signature) {
+					logger.Log.Info("request signature mismatch", zap.String("uri", r.RequestURI))
+					http.Error(w, "invalid signature", http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			sw := &signingResponseWriter{
+				ResponseWriter: w,
+				status:         http.StatusOK,
+			}
+			next.ServeHTTP(sw, r)
+			if sw.streaming {
+				return
+			}
+			w.Header().Set(hash.Header, hash.Sign(key, sw.body.Bytes()))
+			w.WriteHeader(sw.status)
+			if _, err := w.Write(sw.body.Bytes()); err != nil {
+				logger.Log.Error("failed to write response", zap.Error(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/logger"
+)
+
+const (
+	// cleanupInterval - как часто удалять корзины клиентов, которые успели полностью пополниться.
+	cleanupInterval = time.Minute
+	// maxAgentsPerIP - сколько агентов с одного IP получают отдельные корзины. Остальные делят корзину IP,
+	// иначе клиент мог бы обходить лимит и раздувать память, меняя X-Agent-ID в каждом запросе.
+	maxAgentsPerIP = 16
+)
+
+var ErrIncorrectRateLimit = errors.New("incorrect rate limit")
+
+// RateLimit - сколько запросов в секунду разрешено клиенту и сколько можно сделать подряд.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseRateLimit разбирает лимит вида "rate" или "rate:burst".
+// Без burst клиент может сделать подряд столько запросов, сколько разрешено за секунду.
+func ParseRateLimit(s string) (RateLimit, error) {
+	rateStr, burstStr, hasBurst := strings.Cut(s, ":")
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return RateLimit{}, fmt.Errorf("%w: bad rate %q", ErrIncorrectRateLimit, rateStr)
+	}
+	limit := RateLimit{Rate: rate, Burst: int(math.Max(1, math.Ceil(rate)))}
+	if hasBurst {
+		limit.Burst, err = strconv.Atoi(burstStr)
+		if err != nil || limit.Burst < 1 {
+			return RateLimit{}, fmt.Errorf("%w: bad burst %q", ErrIncorrectRateLimit, burstStr)
+		}
+	}
+	return limit, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	ip     string
+	agent  bool
+}
+
+// RateLimiter - token bucket на каждого клиента. Клиент определяется по IP и X-Agent-ID,
+// чтобы агенты за одним NAT не делили лимит.
+type RateLimiter struct {
+	limit RateLimit
+	now   func() time.Time
+
+	mux     sync.Mutex
+	buckets map[string]*bucket
+	// agents - сколько корзин агентов заведено на каждый IP
+	agents      map[string]int
+	lastCleanup time.Time
+
+	throttled atomic.Uint64
+}
+
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:       limit,
+		now:         time.Now,
+		buckets:     make(map[string]*bucket),
+		agents:      make(map[string]int),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Throttled возвращает, сколько запросов было отклонено.
+func (l *RateLimiter) Throttled() uint64 {
+	return l.throttled.Load()
+}
+
+// allow списывает токен клиента. Если токенов нет, возвращает, через сколько появится следующий.
+func (l *RateLimiter) allow(ip, agentID string) (bool, time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := l.now()
+	if now.Sub(l.lastCleanup) >= cleanupInterval {
+		l.cleanup(now)
+	}
+	b := l.bucket(ip, agentID, now)
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// bucket находит или заводит корзину клиента. Вызывается под l.mux.
+func (l *RateLimiter) bucket(ip, agentID string, now time.Time) *bucket {
+	if agentID != "" {
+		if b, found := l.buckets[ip+"|"+agentID]; found {
+			return b
+		}
+		if l.agents[ip] < maxAgentsPerIP {
+			b := &bucket{tokens: float64(l.limit.Burst), last: now, ip: ip, agent: true}
+			l.buckets[ip+"|"+agentID] = b
+			l.agents[ip]++
+			return b
+		}
+	}
+	b, found := l.buckets[ip]
+	if !found {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now, ip: ip}
+		l.buckets[ip] = b
+	}
+	return b
+}
+
+// cleanup удаляет корзины, которые пополнились бы до полной: такая корзина ничем не отличается от новой,
+// поэтому память ограничена клиентами, активными за последнее время. Вызывается под l.mux.
+func (l *RateLimiter) cleanup(now time.Time) {
+	refill := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) < refill {
+			continue
+		}
+		delete(l.buckets, key)
+		if b.agent {
+			if l.agents[b.ip]--; l.agents[b.ip] == 0 {
+				delete(l.agents, b.ip)
+			}
+		}
+	}
+	l.lastCleanup = now
+}
+
+// client возвращает IP клиента и X-Agent-ID, если агент его передал.
+func client(r *http.Request) (string, string) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host, r.Header.Get("X-Agent-ID")
+}
+
+// RateLimitMiddleware ограничивает частоту запросов клиентов отдельно для каждой группы маршрутов.
+// group относит запрос к группе, запросы групп без лимитера не ограничиваются.
+// Отклонённые запросы получают 429 и Retry-After в секундах.
+func RateLimitMiddleware(
+	limiters map[string]*RateLimiter,
+	group func(r *http.Request) string,
+) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := group(r)
+			limiter, ok := limiters[name]
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			ip, agentID := client(r)
+			allowed, wait := limiter.allow(ip, agentID)
+			if !allowed {
+				limiter.throttled.Add(1)
+				logger.Log.Debug("request throttled",
+					zap.String("group", name), zap.String("ip", ip), zap.String("agent_id", agentID))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    RateLimit
+		wantErr bool
+	}{
+		{spec: "10", want: RateLimit{Rate: 10, Burst: 10}},
+		{spec: "0.5", want: RateLimit{Rate: 0.5, Burst: 1}},
+		{spec: "2:20", want: RateLimit{Rate: 2, Burst: 20}},
+		{spec: "", wantErr: true},
+		{spec: "0", wantErr: true},
+		{spec: "-1", wantErr: true},
+		{spec: "1:0", wantErr: true},
+		{spec: "1:x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			limit, err := ParseRateLimit(tt.spec)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrIncorrectRateLimit)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, limit)
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(RateLimit{Rate: 0.5, Burst: 2})
+	limiter.now = func() time.Time { return now }
+	handler := RateLimitMiddleware(map[string]*RateLimiter{"update": limiter}, func(r *http.Request) string {
+		if r.URL.Path == "/ping" {
+			return ""
+		}
+		return "update"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		agentID    string
+		advance    time.Duration
+		code       int
+		retryAfter string
+	}{
+		{name: "burst 1", path: "/update/", remoteAddr: "10.0.0.1:1000", code: http.StatusOK},
+		{name: "burst 2", path: "/update/", remoteAddr: "10.0.0.1:1001", code: http.StatusOK},
+		{name: "exhausted", path: "/update/", remoteAddr: "10.0.0.1:1002", code: http.StatusTooManyRequests, retryAfter: "2"},
+		{name: "unlimited group", path: "/ping", remoteAddr: "10.0.0.1:1003", code: http.StatusOK},
+		{name: "other ip", path: "/update/", remoteAddr: "10.0.0.2:1000", code: http.StatusOK},
+		{name: "agent behind same ip", path: "/update/", remoteAddr: "10.0.0.1:1004", agentID: "web-1", code: http.StatusOK},
+		{name: "partial refill", path: "/update/", remoteAddr: "10.0.0.1:1005", advance: time.Second,
+			code: http.StatusTooManyRequests, retryAfter: "1"},
+		{name: "refilled", path: "/update/", remoteAddr: "10.0.0.1:1006", advance: time.Second, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.agentID != "" {
+			req.Header.Set("X-Agent-ID", tt.agentID)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, tt.code, w.Code, tt.name)
+		assert.Equal(t, tt.retryAfter, w.Header().Get("Retry-After"), tt.name)
+	}
+	assert.Equal(t, uint64(2), limiter.Throttled())
+
+	// Через минуту корзины всех клиентов пополнились, при следующем запросе они удаляются.
+	now = now.Add(cleanupInterval)
+	allowed, _ := limiter.allow("10.0.0.3", "")
+	assert.True(t, allowed)
+	assert.Len(t, limiter.buckets, 1)
+	assert.Empty(t, limiter.agents)
+}
+
+// Клиент, который меняет X-Agent-ID в каждом запросе, получает не больше maxAgentsPerIP отдельных корзин,
+// дальше делит корзину своего IP.
+func TestRateLimiter_RotatingAgentID(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Rate: 0.5, Burst: 2})
+	allowed := 0
+	for i := 0; i < 2*maxAgentsPerIP; i++ {
+		if ok, _ := limiter.allow("10.0.0.1", fmt.Sprintf("agent-%d", i)); ok {
+			allowed++
+		}
+	}
+	assert.Equal(t, maxAgentsPerIP+2, allowed)
+	assert.Len(t, limiter.buckets, maxAgentsPerIP+1)
+
+	// Агенты, получившие корзину раньше, не страдают от соседа.
+	ok, _ := limiter.allow("10.0.0.1", "agent-0")
+	assert.True(t, ok)
+	ok, _ = limiter.allow("10.0.0.2", "agent-100")
+	assert.True(t, ok)
+}
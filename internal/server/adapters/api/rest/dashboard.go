@@ -0,0 +1,243 @@
+package rest
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	dashboardRefresh = 10
+	detailHistory    = 20
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var (
+	dashboardTemplate = template.Must(template.ParseFS(templateFS, "templates/dashboard.html", "templates/layout.html"))
+	metricTemplate    = template.Must(template.ParseFS(templateFS, "templates/metric.html", "templates/layout.html"))
+)
+
+type dashboardRow struct {
+	ID          string
+	Labels      string
+	Value       string
+	Unit        string
+	Description string
+	Stale       bool
+	Link        string
+}
+
+type dashboardGroup struct {
+	Type    string
+	Metrics []dashboardRow
+}
+
+type dashboardPage struct {
+	Title   string
+	Refresh int
+	Groups  []dashboardGroup
+}
+
+type metricPage struct {
+	Title   string
+	Metric  *domain.MetricDetails
+	Meta    *domain.Meta
+	Value   string
+	History []domain.Sample
+}
+
+func formatValue(m *domain.Metric) string {
+	switch {
+	case m.Histogram != nil:
+		return formatHistogram(m.Histogram)
+	case m.Summary != nil:
+		return formatSummary(m.Summary)
+	case m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	case m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	default:
+		return ""
+	}
+}
+
+// formatHistogram показывает количество, сумму и число значений в каждой корзине.
+func formatHistogram(h *domain.HistogramData) string {
+	var b strings.Builder
+	b.WriteString("count ")
+	b.WriteString(strconv.FormatUint(h.Count, 10))
+	b.WriteString(", sum ")
+	b.WriteString(strconv.FormatFloat(h.Sum, 'f', -1, 64))
+	b.WriteString(";")
+	for _, bucket := range h.Buckets() {
+		b.WriteString(" ≤")
+		b.WriteString(bucket.Upper)
+		b.WriteString(": ")
+		b.WriteString(strconv.FormatUint(bucket.Count, 10))
+	}
+	return b.String()
+}
+
+// formatSummary показывает количество, сумму и квантили по умолчанию.
+func formatSummary(s *domain.Sketch) string {
+	var b strings.Builder
+	b.WriteString("count ")
+	b.WriteString(strconv.FormatUint(s.Count, 10))
+	b.WriteString(", sum ")
+	b.WriteString(strconv.FormatFloat(s.Sum, 'f', -1, 64))
+	b.WriteString(";")
+	for _, q := range domain.DefaultQuantiles {
+		value, err := s.Quantile(q)
+		if err != nil {
+			continue
+		}
+		b.WriteString(" p")
+		b.WriteString(strconv.FormatFloat(q*100, 'f', -1, 64))
+		b.WriteString(": ")
+		b.WriteString(strconv.FormatFloat(value, 'g', 6, 64))
+	}
+	return b.String()
+}
+
+func metricLink(m *domain.Metric) string {
+	link := "/view/" + url.PathEscape(m.MType) + "/" + url.PathEscape(m.ID)
+	if len(m.Labels) > 0 {
+		link += "?" + url.Values{"labels": {m.Labels.String()}}.Encode()
+	}
+	return link
+}
+
+// groupMetrics раскладывает метрики по типам, типы и метрики внутри них упорядочены по имени.
+// Единицы и описания берутся из реестра.
+func groupMetrics(metrics domain.MetricsList, registry domain.Registry) []dashboardGroup {
+	slices.SortFunc(metrics, func(a, b domain.Metric) int {
+		q := domain.MetricQuery{SortBy: domain.SortByType}
+		return q.Compare(&a, &b)
+	})
+	groups := make([]dashboardGroup, 0)
+	for i := range metrics {
+		m := &metrics[i]
+		if len(groups) == 0 || groups[len(groups)-1].Type != m.MType {
+			groups = append(groups, dashboardGroup{Type: m.MType})
+		}
+		group := &groups[len(groups)-1]
+		meta := registry[m.ID]
+		group.Metrics = append(group.Metrics, dashboardRow{
+			ID:          m.ID,
+			Labels:      m.Labels.String(),
+			Value:       formatValue(m),
+			Unit:        meta.Unit,
+			Description: meta.Description,
+			Stale:       m.Stale,
+			Link:        metricLink(m),
+		})
+	}
+	return groups
+}
+
+// renderTemplate рендерит страницу в буфер, чтобы ошибка шаблона не оставила клиенту половину HTML.
+func renderTemplate(w http.ResponseWriter, t *template.Template, data any) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		logger.Log.Error("failed to render template", zap.String("template", t.Name()), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("failed to write response", zap.Error(err))
+	}
+}
+
+func (h *handler) GetAllMetrics(w http.ResponseWriter, req *http.Request) {
+	metrics, err := h.metricService.GetAllMetrics()
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Log.Error("failed to get all metrics", zap.Error(err))
+		return
+	}
+	registry, err := h.metricService.GetAllMeta()
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Log.Error("failed to get metadata", zap.Error(err))
+		return
+	}
+	renderTemplate(w, dashboardTemplate, dashboardPage{
+		Title:   "Metrics",
+		Refresh: dashboardRefresh,
+		Groups:  groupMetrics(metrics, registry),
+	})
+}
+
+// pathParam возвращает параметр маршрута без экранирования. chi матчит маршрут по RawPath,
+// если он задан, и тогда параметры приходят в экранированном виде.
+func pathParam(req *http.Request, key string) (string, error) {
+	value := chi.URLParam(req, key)
+	if req.URL.RawPath == "" {
+		return value, nil
+	}
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad path parameter %s", errBadQuery, key)
+	}
+	return unescaped, nil
+}
+
+func (h *handler) ViewMetric(w http.ResponseWriter, req *http.Request) {
+	mType, err := pathParam(req, metricType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mName, err := pathParam(req, metricName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	labels, err := parseLabels(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := domain.Key{MType: mType, ID: mName, Labels: labels.String()}
+	details, err := h.metricService.GetMetricDetails(key)
+	if err != nil {
+		handleGetMetricError(w, err)
+		return
+	}
+	history, err := h.metricService.GetHistory(key, time.Time{}, time.Time{}, 0)
+	if err != nil && !errors.Is(err, domain.ErrHistoryDisabled) {
+		logger.Log.Error("failed to get history", zap.Error(err))
+	}
+	if len(history) > detailHistory {
+		history = history[len(history)-detailHistory:]
+	}
+	slices.Reverse(history)
+	meta, err := h.metricService.GetMeta(mName)
+	if err != nil && !errors.Is(err, domain.ErrItemNotFound) {
+		logger.Log.Error("failed to get metadata", zap.Error(err))
+	}
+	renderTemplate(w, metricTemplate, metricPage{
+		Title:   mName,
+		Metric:  details,
+		Meta:    meta,
+		Value:   formatValue(&details.Metric),
+		History: history,
+	})
+}
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"metrics/internal/server/core/domain"
+)
+
+type historyResponse struct {
+	ID      string          `json:"id"`
+	MType   string          `json:"type"`
+	Samples []domain.Sample `json:"samples"`
+}
+
+// parseTime принимает время в RFC 3339 или в секундах Unix.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: bad time %q", errBadQuery, value)
+	}
+	return t, nil
+}
+
+func parseHistoryQuery(values url.Values) (from, to time.Time, step time.Duration, err error) {
+	if from, err = parseTime(values.Get("from")); err != nil {
+		return
+	}
+	if to, err = parseTime(values.Get("to")); err != nil {
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		err = fmt.Errorf("%w: to is before from", errBadQuery)
+		return
+	}
+	if raw := values.Get("step"); raw != "" {
+		step, err = time.ParseDuration(raw)
+		if err != nil || step < 0 {
+			err = fmt.Errorf("%w: bad step %q", errBadQuery, raw)
+			return
+		}
+	}
+	return
+}
+
+// parseQuantiles читает квантили из параметра q: через запятую или повторением параметра.
+func parseQuantiles(values url.Values) ([]float64, error) {
+	qs := make([]float64, 0)
+	for _, param := range values["q"] {
+		for _, raw := range strings.Split(param, ",") {
+			q, err := strconv.ParseFloat(raw, 64)
+			if err != nil || q < 0 || q > 1 {
+				return nil, fmt.Errorf("%w: %w %q", errBadQuery, domain.ErrIncorrectQuantile, raw)
+			}
+			qs = append(qs, q)
+		}
+	}
+	if len(qs) == 0 {
+		return domain.DefaultQuantiles, nil
+	}
+	return qs, nil
+}
+
+func parseAggregateQuery(values url.Values) (domain.Aggregation, time.Duration, error) {
+	fn, err := domain.ParseAggregation(values.Get("fn"))
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %w %q", errBadQuery, err, values.Get("fn"))
+	}
+	window, err := time.ParseDuration(values.Get("window"))
+	if err != nil || window <= 0 {
+		return "", 0, fmt.Errorf("%w: bad window %q", errBadQuery, values.Get("window"))
+	}
+	return fn, window, nil
+}
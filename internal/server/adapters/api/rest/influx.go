@@ -0,0 +1,182 @@
+package rest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"metrics/internal/server/core/domain"
+)
+
+var errInfluxSyntax = errors.New("invalid line protocol")
+
+type influxLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type influxWriteResult struct {
+	Written int               `json:"written"`
+	Errors  []influxLineError `json:"errors"`
+}
+
+// splitInflux делит строку по sep, пропуская экранированные символы и содержимое кавычек.
+func splitInflux(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// sanitizeInfluxTag приводит ключ тега к имени метки, как это делают экспортеры Prometheus:
+// недопустимые символы заменяются на "_", а имена, которые начинаются с цифры или "__"
+// либо совпадают с зарезервированными, получают префикс "tag_". Так host-name становится host_name.
+func sanitizeInfluxTag(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	name := b.String()
+	if (name[0] >= '0' && name[0] <= '9') || (domain.Labels{name: ""}).Validate() != nil {
+		name = "tag_" + name
+	}
+	return name
+}
+
+func parseInfluxField(measurement, field string) (domain.Metric, error) {
+	kv := splitInflux(field, '=')
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return domain.Metric{}, fmt.Errorf("%w: bad field %q", errInfluxSyntax, field)
+	}
+	id := measurement + "_" + unescapeInflux(kv[0])
+	raw := kv[1]
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		return domain.Metric{}, fmt.Errorf("%w: string field %q is not supported", errInfluxSyntax, kv[0])
+	case strings.HasSuffix(raw, "i"), strings.HasSuffix(raw, "u"):
+		delta, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return domain.Metric{}, fmt.Errorf("%w: bad integer %q", errInfluxSyntax, raw)
+		}
+		if strings.HasSuffix(raw, "u") && delta < 0 {
+			return domain.Metric{}, fmt.Errorf("%w: bad unsigned integer %q", errInfluxSyntax, raw)
+		}
+		return domain.Metric{ID: id, MType: domain.Counter, Delta: &delta}, nil
+	}
+	switch raw {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return domain.Metric{}, fmt.Errorf("%w: boolean field %q is not supported", errInfluxSyntax, kv[0])
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return domain.Metric{}, fmt.Errorf("%w: bad float %q", errInfluxSyntax, raw)
+	}
+	return domain.Metric{ID: id, MType: domain.Gauge, Value: &value}, nil
+}
+
+// parseInfluxLine разбирает строку measurement[,tag=value...] field=value[,...] [timestamp].
+// Теги становятся метками каждой метрики строки, ключи тегов приводятся к допустимым именам меток.
+func parseInfluxLine(line string) (domain.MetricsList, error) {
+	sections := splitInflux(line, ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, fmt.Errorf("%w: expected measurement, fields and optional timestamp", errInfluxSyntax)
+	}
+	series := splitInflux(sections[0], ',')
+	measurement := unescapeInflux(series[0])
+	if measurement == "" {
+		return nil, fmt.Errorf("%w: empty measurement", errInfluxSyntax)
+	}
+	var labels domain.Labels
+	for _, tag := range series[1:] {
+		kv := splitInflux(tag, '=')
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("%w: bad tag %q", errInfluxSyntax, tag)
+		}
+		if labels == nil {
+			labels = make(domain.Labels, len(series)-1)
+		}
+		key := unescapeInflux(kv[0])
+		name := sanitizeInfluxTag(key)
+		if _, found := labels[name]; found {
+			return nil, fmt.Errorf("%w: tag %q duplicates label %q", domain.ErrIncorrectLabels, key, name)
+		}
+		labels[name] = unescapeInflux(kv[1])
+	}
+	if len(sections) == 3 {
+		if _, err := strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: bad timestamp %q", errInfluxSyntax, sections[2])
+		}
+	}
+	fields := splitInflux(sections[1], ',')
+	metrics := make(domain.MetricsList, 0, len(fields))
+	for _, field := range fields {
+		m, err := parseInfluxField(measurement, field)
+		if err != nil {
+			return nil, err
+		}
+		m.Labels = labels
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// parseInflux возвращает метрики из корректных строк и ошибки по остальным.
+func parseInflux(r io.Reader) (domain.MetricsList, []influxLineError, error) {
+	var (
+		metrics domain.MetricsList
+		errs    []influxLineError
+	)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parsed, err := parseInfluxLine(line)
+		if err != nil {
+			errs = append(errs, influxLineError{Line: n, Error: err.Error()})
+			continue
+		}
+		metrics = append(metrics, parsed...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read line protocol: %w", err)
+	}
+	return metrics, errs, nil
+}
@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"metrics/internal/server/core/domain"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var errBadQuery = errors.New("bad query")
+
+type metricListResponse struct {
+	Metrics    domain.MetricsList `json:"metrics"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// cursor - ключ сортировки последней метрики страницы. Значение нужно только при сортировке по value.
+type cursor struct {
+	MType  string   `json:"t"`
+	ID     string   `json:"i"`
+	Labels string   `json:"l,omitempty"`
+	Value  *float64 `json:"v,omitempty"`
+	Delta  *int64   `json:"d,omitempty"`
+}
+
+func encodeCursor(m *domain.Metric, sortBy string) (string, error) {
+	c := cursor{MType: m.MType, ID: m.ID, Labels: m.Labels.String()}
+	if sortBy == domain.SortByValue {
+		c.Value, c.Delta = m.Value, m.Delta
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(s string) (*domain.Metric, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad cursor", errBadQuery)
+	}
+	var c cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: bad cursor", errBadQuery)
+	}
+	labels, err := domain.ParseLabels(c.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad cursor", errBadQuery)
+	}
+	return &domain.Metric{MType: c.MType, ID: c.ID, Labels: labels, Value: c.Value, Delta: c.Delta}, nil
+}
+
+// parseMetricFilter читает фильтры type, prefix, glob, regex и селекторы меток label=name=value.
+func parseMetricFilter(values url.Values) (*domain.MetricQuery, error) {
+	q := &domain.MetricQuery{
+		MType:  values.Get("type"),
+		Prefix: values.Get("prefix"),
+		Glob:   values.Get("glob"),
+	}
+	if q.Glob != "" {
+		if _, err := path.Match(q.Glob, ""); err != nil {
+			return nil, fmt.Errorf("%w: bad glob: %w", errBadQuery, err)
+		}
+	}
+	if expr := values.Get("regex"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad regex: %w", errBadQuery, err)
+		}
+		q.Regex = re
+	}
+	for _, selector := range values["label"] {
+		name, value, found := strings.Cut(selector, "=")
+		if !found {
+			return nil, fmt.Errorf("%w: label selector must be name=value", errBadQuery)
+		}
+		if q.Labels == nil {
+			q.Labels = make(domain.Labels)
+		}
+		q.Labels[name] = value
+	}
+	if err := q.Labels.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadQuery, err)
+	}
+	return q, nil
+}
+
+// parseLabels читает метки конкретной метрики из параметра labels в каноническом виде.
+func parseLabels(values url.Values) (domain.Labels, error) {
+	labels, err := domain.ParseLabels(values.Get("labels"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadQuery, err)
+	}
+	return labels, nil
+}
+
+// metricKey собирает ключ метрики из пути запроса и параметра labels.
+func metricKey(req *http.Request, mType string) (domain.Key, error) {
+	labels, err := parseLabels(req.URL.Query())
+	if err != nil {
+		return domain.Key{}, err
+	}
+	return domain.Key{MType: mType, ID: chi.URLParam(req, metricName), Labels: labels.String()}, nil
+}
+
+// parseMetricQuery дополняет фильтры параметрами sort, order, limit и cursor.
+func parseMetricQuery(values url.Values) (*domain.MetricQuery, error) {
+	q, err := parseMetricFilter(values)
+	if err != nil {
+		return nil, err
+	}
+	q.SortBy = domain.SortByID
+	q.Limit = defaultListLimit
+	switch sortBy := values.Get("sort"); sortBy {
+	case "":
+	case domain.SortByID, domain.SortByType, domain.SortByValue:
+		q.SortBy = sortBy
+	default:
+		return nil, fmt.Errorf("%w: unknown sort field %q", errBadQuery, sortBy)
+	}
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, fmt.Errorf("%w: unknown order %q", errBadQuery, order)
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxListLimit {
+			return nil, fmt.Errorf("%w: limit must be between 1 and %d", errBadQuery, maxListLimit)
+		}
+		q.Limit = n
+	}
+	if c := values.Get("cursor"); c != "" {
+		after, err := decodeCursor(c)
+		if err != nil {
+			return nil, err
+		}
+		q.After = after
+	}
+	return q, nil
+}
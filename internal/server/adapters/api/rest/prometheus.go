@@ -0,0 +1,233 @@
+package rest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// sanitizePrometheusName приводит ID метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*.
+func sanitizePrometheusName(id string) string {
+	var b strings.Builder
+	for i, r := range id {
+		switch {
+		case r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func formatPrometheusValue(m *domain.Metric) (string, bool) {
+	switch m.MType {
+	case domain.Gauge:
+		if m.Value == nil {
+			return "", false
+		}
+		switch {
+		case math.IsInf(*m.Value, 1):
+			return "+Inf", true
+		case math.IsInf(*m.Value, -1):
+			return "-Inf", true
+		case math.IsNaN(*m.Value):
+			return "NaN", true
+		}
+		return strconv.FormatFloat(*m.Value, 'g', -1, 64), true
+	case domain.Counter:
+		if m.Delta == nil {
+			return "", false
+		}
+		return strconv.FormatInt(*m.Delta, 10), true
+	case domain.Histogram:
+		return "", m.Histogram != nil
+	case domain.Summary:
+		return "", m.Summary != nil
+	default:
+		return "", false
+	}
+}
+
+func escapePrometheusHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// writePrometheusHistogram пишет серии _bucket с накопленными счётчиками, _sum и _count.
+func writePrometheusHistogram(w io.Writer, name string, labels domain.Labels, h *domain.HistogramData) error {
+	bucketLabels := make(domain.Labels, len(labels)+1)
+	for k, v := range labels {
+		bucketLabels[k] = v
+	}
+	var cumulative uint64
+	for _, b := range h.Buckets() {
+		cumulative += b.Count
+		bucketLabels["le"] = b.Upper
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatPrometheusLabels(bucketLabels), cumulative); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+	suffix := formatPrometheusLabels(labels)
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n",
+		name, suffix, strconv.FormatFloat(h.Sum, 'g', -1, 64), name, suffix, h.Count)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// writePrometheusSummary пишет квантили по умолчанию, _sum и _count.
+func writePrometheusSummary(w io.Writer, name string, labels domain.Labels, s *domain.Sketch) error {
+	quantileLabels := make(domain.Labels, len(labels)+1)
+	for k, v := range labels {
+		quantileLabels[k] = v
+	}
+	for _, q := range domain.DefaultQuantiles {
+		value, err := s.Quantile(q)
+		if err != nil {
+			continue
+		}
+		quantileLabels["quantile"] = strconv.FormatFloat(q, 'g', -1, 64)
+		_, err = fmt.Fprintf(w, "%s%s %s\n",
+			name, formatPrometheusLabels(quantileLabels), strconv.FormatFloat(value, 'g', -1, 64))
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+	suffix := formatPrometheusLabels(labels)
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n",
+		name, suffix, strconv.FormatFloat(s.Sum, 'g', -1, 64), name, suffix, s.Count)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// formatPrometheusLabels возвращает метки в виде {name="value",...} с именами по алфавиту.
+func formatPrometheusLabels(labels domain.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escape.Replace(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// writePrometheus пишет метрики в текстовом формате Prometheus, отсортированными по имени.
+// Метрики с одним ID и разными метками выводятся одним семейством. Если после нормализации
+// имена разных метрик совпадают, остаётся первая, остальные пропускаются.
+func writePrometheus(w io.Writer, metrics domain.MetricsList, help map[string]string) error {
+	type sample struct {
+		name   string
+		mType  string
+		id     string
+		labels string
+		value  string
+		metric *domain.Metric
+	}
+	samples := make([]sample, 0, len(metrics))
+	for i := range metrics {
+		value, ok := formatPrometheusValue(&metrics[i])
+		if !ok {
+			continue
+		}
+		samples = append(samples, sample{
+			name:   sanitizePrometheusName(metrics[i].ID),
+			mType:  metrics[i].MType,
+			id:     metrics[i].ID,
+			labels: formatPrometheusLabels(metrics[i].Labels),
+			value:  value,
+			metric: &metrics[i],
+		})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].name != samples[j].name {
+			return samples[i].name < samples[j].name
+		}
+		if samples[i].mType != samples[j].mType {
+			return samples[i].mType < samples[j].mType
+		}
+		if samples[i].id != samples[j].id {
+			return samples[i].id < samples[j].id
+		}
+		return samples[i].labels < samples[j].labels
+	})
+	bw := bufio.NewWriter(w)
+	var family sample
+	for _, s := range samples {
+		if s.name == family.name {
+			if s.mType != family.mType || s.id != family.id {
+				logger.Log.Warn("skip metric with duplicate prometheus name",
+					zap.String("name", s.name),
+					zap.String(metricType, s.mType),
+					zap.String(metricName, s.id),
+				)
+				continue
+			}
+		} else {
+			family = s
+			if text, ok := help[s.id]; ok && text != "" {
+				if _, err := fmt.Fprintf(bw, "# HELP %s %s\n", s.name, escapePrometheusHelp(text)); err != nil {
+					return fmt.Errorf("failed to write metrics: %w", err)
+				}
+			}
+			if _, err := fmt.Fprintf(bw, "# TYPE %s %s\n", s.name, s.mType); err != nil {
+				return fmt.Errorf("failed to write metrics: %w", err)
+			}
+		}
+		switch s.mType {
+		case domain.Histogram:
+			if err := writePrometheusHistogram(bw, s.name, s.metric.Labels, s.metric.Histogram); err != nil {
+				return fmt.Errorf("failed to write metrics: %w", err)
+			}
+			continue
+		case domain.Summary:
+			if err := writePrometheusSummary(bw, s.name, s.metric.Labels, s.metric.Summary); err != nil {
+				return fmt.Errorf("failed to write metrics: %w", err)
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(bw, "%s%s %s\n", s.name, s.labels, s.value); err != nil {
+			return fmt.Errorf("failed to write metrics: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
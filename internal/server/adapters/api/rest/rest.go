@@ -2,13 +2,16 @@ package rest
 
 import (
 	"context"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -25,18 +28,52 @@ const (
 	metricType  = "metricType"
 	metricValue = "metricValue"
 	metricName  = "metricName"
+	// agentIDHeader - необязательный заголовок, которым агент представляется серверу.
+	agentIDHeader = "X-Agent-ID"
+
+	// группы маршрутов с отдельными лимитами частоты запросов
+	updateGroup = "update"
+	valueGroup  = "value"
+	rootGroup   = "root"
+	// throttledMetric - счётчик запросов, отклонённых ограничителем частоты
+	throttledMetric = "http_requests_throttled"
 )
 
 type MetricService interface {
-	GetMetric(mType, mName string) (*domain.Metric, error)
-	GetMetricValue(mType, mName string) (string, error)
+	GetMetric(key domain.Key) (*domain.Metric, error)
+	GetMetricDetails(key domain.Key) (*domain.MetricDetails, error)
+	GetMetricValue(key domain.Key) (string, error)
 	SetMetric(m *domain.Metric) (*domain.Metric, error)
+	SetMetrics(metrics domain.MetricsList) (domain.MetricsList, error)
 	SetMetricValue(m *domain.SetMetricRequest) (*domain.Metric, error)
 	GetAllMetrics() (domain.MetricsList, error)
+	QueryMetrics(q *domain.MetricQuery) (domain.MetricPage, error)
+	DeleteMetric(key domain.Key) error
+	DeleteMetrics(q *domain.MetricQuery) (int, error)
+	ResetCounter(key domain.Key) (*domain.Metric, error)
+	GetHistory(key domain.Key, from, to time.Time, step time.Duration) ([]domain.Sample, error)
+	Aggregate(key domain.Key, fn domain.Aggregation, window time.Duration) (*domain.AggregateResult, error)
+	Quantiles(key domain.Key, qs []float64) (*domain.QuantileResult, error)
+	Subscribe(filter *domain.MetricQuery) (<-chan domain.Metric, func())
+	SetMeta(meta *domain.Meta) error
+	GetMeta(name string) (*domain.Meta, error)
+	GetAllMeta() (domain.Registry, error)
+	GetAgents() ([]domain.Agent, error)
+	Health() domain.Health
+}
+
+// AlertSource - активные срабатывания правил алертинга.
+type AlertSource interface {
+	Alerts() []domain.Alert
 }
 
 type handler struct {
 	metricService MetricService
+	alerts        AlertSource
+	// limiters - ограничители частоты запросов по группам маршрутов, число отклонённых запросов отдаётся в /metrics
+	limiters map[string]*middleware.RateLimiter
+	// shutdown закрывается при остановке сервера, чтобы завершить открытые потоки событий.
+	shutdown chan struct{}
 }
 
 type API struct {
@@ -60,30 +97,125 @@ func (a *API) Run() error {
 	return nil
 }
 
-func NewAPI(metricService MetricService, cfg *config.Config) *API {
+func NewAPI(
+	metricService MetricService,
+	alerts AlertSource,
+	cfg *config.Config,
+	privateKey *rsa.PrivateKey,
+) (*API, error) {
+	limiters, err := newRateLimiters(cfg)
+	if err != nil {
+		return nil, err
+	}
 	h := &handler{
 		metricService: metricService,
+		alerts:        alerts,
+		limiters:      limiters,
+		shutdown:      make(chan struct{}),
+	}
+	var subnet *net.IPNet
+	if cfg.TrustedSubnet != "" {
+		_, network, err := net.ParseCIDR(cfg.TrustedSubnet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trusted subnet: %w", err)
+		}
+		subnet = network
+	}
+	trusted := middleware.TrustedSubnetMiddleware(subnet)
+	readTrusted := middleware.TrustedSubnetMiddleware(nil)
+	if cfg.TrustedReads {
+		readTrusted = trusted
 	}
 	r := chi.NewRouter()
 	r.Use(middleware.LoggingRequestMiddleware)
+	r.Use(middleware.RateLimitMiddleware(limiters, routeGroup))
+	r.Use(middleware.DecryptRequestMiddleware(privateKey))
 	r.Use(middleware.CompressRequestMiddleware)
 	r.Use(middleware.CompressResponseMiddleware)
-	r.Route("/update", func(r chi.Router) {
-		r.Post("/", h.SetMetric)
-		r.Post("/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+	r.Use(middleware.SignMiddleware(cfg.Key))
+	r.Group(func(r chi.Router) {
+		r.Use(trusted)
+		r.Route("/update", func(r chi.Router) {
+			r.Post("/", h.SetMetric)
+			r.Post("/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+		})
+		r.Post("/updates/", h.SetMetrics)
+		r.Post("/write", h.WriteInflux)
+		r.Delete("/value/{metricType}/{metricName}", h.DeleteMetric)
+		r.Delete("/api/v1/metrics", h.DeleteMetrics)
+		r.Post("/reset/counter/{metricName}", h.ResetCounter)
+		r.Put("/api/v1/meta/{metricName}", h.SetMeta)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(readTrusted)
+		r.Post("/value/", h.GetMetric)
+		r.Get("/value/{metricType}/{metricName}", h.GetMetricValue)
+		r.Get("/", h.GetAllMetrics)
+		r.Get("/view/{metricType}/{metricName}", h.ViewMetric)
+		r.Get("/metrics", h.GetPrometheusMetrics)
+		r.Get("/api/v1/metrics", h.ListMetrics)
+		r.Get("/api/v1/history/{metricType}/{metricName}", h.GetHistory)
+		r.Get("/api/v1/query/{metricType}/{metricName}", h.QueryAggregate)
+		r.Get("/api/v1/quantiles/{metricName}", h.GetQuantiles)
+		r.Get("/api/v1/stream", h.Stream)
+		r.Get("/api/v1/agents", h.ListAgents)
+		r.Get("/api/v1/alerts", h.ListAlerts)
+		r.Get("/api/v1/meta", h.ListMeta)
+		r.Get("/api/v1/meta/{metricName}", h.GetMeta)
 	})
-	r.Route("/value", func(r chi.Router) {
-		r.Post("/", h.GetMetric)
-		r.Get("/{metricType}/{metricName}", h.GetMetricValue)
+	r.Get("/ping", h.Ping)
+	srv := &http.Server{
+		Addr:         cfg.Address,
+		Handler:      r,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+	srv.RegisterOnShutdown(func() {
+		close(h.shutdown)
 	})
-	r.Get("/", h.GetAllMetrics)
 	return &API{
-		srv: &http.Server{
-			Addr:         cfg.Address,
-			Handler:      r,
-			ReadTimeout:  time.Second,
-			WriteTimeout: time.Second,
-		},
+		srv: srv,
+	}, nil
+}
+
+// newRateLimiters создаёт ограничители для групп маршрутов с заданным лимитом.
+func newRateLimiters(cfg *config.Config) (map[string]*middleware.RateLimiter, error) {
+	specs := map[string]string{
+		updateGroup: cfg.RateLimitUpdate,
+		valueGroup:  cfg.RateLimitValue,
+		rootGroup:   cfg.RateLimitRoot,
+	}
+	limiters := make(map[string]*middleware.RateLimiter)
+	for group, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		limit, err := middleware.ParseRateLimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s rate limit: %w", group, err)
+		}
+		limiters[group] = middleware.NewRateLimiter(limit)
+	}
+	return limiters, nil
+}
+
+// routeGroup относит запрос к группе лимитов: запись метрик, чтение через /value и все остальные маршруты.
+// Запросы, изменяющие данные, относятся к записи по методу, даже если путь совпадает с чтением,
+// как DELETE /value/{type}/{name}. Исключение - POST /value/, которым значение читается по JSON.
+// /ping не ограничивается, чтобы проверки доступности не отклонялись под нагрузкой.
+func routeGroup(req *http.Request) string {
+	path := req.URL.Path
+	read := req.Method == http.MethodGet || req.Method == http.MethodHead ||
+		(req.Method == http.MethodPost && path == "/value/")
+	switch {
+	case path == "/ping":
+		return ""
+	case !read || strings.HasPrefix(path, "/update") || path == "/write":
+		return updateGroup
+	case strings.HasPrefix(path, "/value/"):
+		return valueGroup
+	default:
+		return rootGroup
 	}
 }
 
@@ -91,7 +223,16 @@ func handleSetMetricError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, domain.ErrItemNotFound):
 		http.Error(w, err.Error(), http.StatusNotFound)
-	case errors.Is(err, domain.ErrIncorrectMetricType) || errors.Is(err, domain.ErrIncorrectMetricValue):
+	case errors.Is(err, domain.ErrIncorrectMetricType) ||
+		errors.Is(err, domain.ErrIncorrectMetricValue) ||
+		errors.Is(err, domain.ErrIncorrectLabels) ||
+		errors.Is(err, domain.ErrIncorrectBuckets) ||
+		errors.Is(err, domain.ErrIncorrectSketch) ||
+		errors.Is(err, domain.ErrIncorrectMeta) ||
+		errors.Is(err, domain.ErrUnregisteredMetric) ||
+		errors.Is(err, domain.ErrMetaMismatch) ||
+		errors.Is(err, domain.ErrValueOutOfRange) ||
+		errors.Is(err, domain.ErrEmptyBatch):
 		http.Error(w, err.Error(), http.StatusBadRequest)
 	default:
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -106,14 +247,33 @@ func handleGetMetricError(w http.ResponseWriter, err error) {
 	}
 }
 
+// requestSource описывает отправителя запроса на запись.
+func requestSource(req *http.Request) *domain.Source {
+	return domain.NewSource(req.RemoteAddr, req.Header.Get(agentIDHeader))
+}
+
+// setSource проставляет отправителя всем метрикам батча.
+func setSource(metrics domain.MetricsList, source *domain.Source) {
+	for i := range metrics {
+		metrics[i].Source = source
+	}
+}
+
 func (h *handler) SetMetricValue(w http.ResponseWriter, req *http.Request) {
 	mType := chi.URLParam(req, metricType)
 	mName := chi.URLParam(req, metricName)
 	mValue := chi.URLParam(req, metricValue)
-	_, err := h.metricService.SetMetricValue(&domain.SetMetricRequest{
-		ID:    mName,
-		MType: mType,
-		Value: mValue,
+	labels, err := parseLabels(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, err = h.metricService.SetMetricValue(&domain.SetMetricRequest{
+		ID:     mName,
+		MType:  mType,
+		Value:  mValue,
+		Labels: labels,
+		Source: requestSource(req),
 	})
 	if err != nil {
 		logger.Log.Error("failed to set metric",
@@ -148,6 +308,7 @@ func (h *handler) SetMetric(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	m.Source = requestSource(req)
 	metric, err := h.metricService.SetMetric(&m)
 
 	if err != nil {
@@ -164,13 +325,79 @@ func (h *handler) SetMetric(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (h *handler) SetMetrics(w http.ResponseWriter, req *http.Request) {
+	var metrics domain.MetricsList
+	if err := json.NewDecoder(req.Body).Decode(&metrics); err != nil {
+		logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	setSource(metrics, requestSource(req))
+	result, err := h.metricService.SetMetrics(metrics)
+	if err != nil {
+		logger.Log.Error("failed to set metrics", zap.Error(err))
+		handleSetMetricError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+// WriteInflux принимает InfluxDB line protocol. Корректные строки записываются,
+// даже если в запросе есть ошибочные: тогда ответ 400 со списком ошибок по строкам.
+func (h *handler) WriteInflux(w http.ResponseWriter, req *http.Request) {
+	metrics, lineErrors, err := parseInflux(req.Body)
+	if err != nil {
+		logger.Log.Info("cannot read line protocol body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result := influxWriteResult{Errors: lineErrors}
+	if len(metrics) > 0 {
+		setSource(metrics, requestSource(req))
+		written, err := h.metricService.SetMetrics(metrics)
+		if err != nil {
+			logger.Log.Error("failed to set metrics", zap.Error(err))
+			handleSetMetricError(w, err)
+			return
+		}
+		result.Written = len(written)
+	}
+	if len(lineErrors) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
 func (h *handler) GetMetricValue(w http.ResponseWriter, req *http.Request) {
-	mType, mName := chi.URLParam(req, metricType), chi.URLParam(req, metricName)
-	metricValue, err := h.metricService.GetMetricValue(mType, mName)
+	key, err := metricKey(req, chi.URLParam(req, metricType))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch key.MType {
+	case domain.Histogram:
+		h.getHistogramValue(w, key)
+		return
+	case domain.Summary:
+		h.writeQuantiles(w, key, domain.DefaultQuantiles)
+		return
+	}
+	metricValue, err := h.metricService.GetMetricValue(key)
 	if err != nil {
 		logger.Log.Error("failed to get metric",
-			zap.String(metricType, mType),
-			zap.String(metricName, mName),
+			zap.String(metricType, key.MType),
+			zap.String(metricName, key.ID),
 			zap.Error(err),
 		)
 		handleGetMetricError(w, err)
@@ -181,6 +408,66 @@ func (h *handler) GetMetricValue(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+type histogramResponse struct {
+	Count   uint64          `json:"count"`
+	Sum     float64         `json:"sum"`
+	Buckets []domain.Bucket `json:"buckets"`
+}
+
+func (h *handler) getHistogramValue(w http.ResponseWriter, key domain.Key) {
+	metric, err := h.metricService.GetMetric(key)
+	if err != nil {
+		logger.Log.Error("failed to get metric",
+			zap.String(metricType, key.MType),
+			zap.String(metricName, key.ID),
+			zap.Error(err),
+		)
+		handleGetMetricError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(histogramResponse{
+		Count:   metric.Histogram.Count,
+		Sum:     metric.Histogram.Sum,
+		Buckets: metric.Histogram.Buckets(),
+	})
+	if err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) GetQuantiles(w http.ResponseWriter, req *http.Request) {
+	key, err := metricKey(req, domain.Summary)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	qs, err := parseQuantiles(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeQuantiles(w, key, qs)
+}
+
+func (h *handler) writeQuantiles(w http.ResponseWriter, key domain.Key, qs []float64) {
+	result, err := h.metricService.Quantiles(key, qs)
+	if err != nil {
+		logger.Log.Error("failed to get quantiles",
+			zap.String(metricName, key.ID),
+			zap.Error(err),
+		)
+		handleGetMetricError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
 func (h *handler) GetMetric(w http.ResponseWriter, req *http.Request) {
 	var m domain.Metric
 	if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
@@ -188,7 +475,7 @@ func (h *handler) GetMetric(w http.ResponseWriter, req *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	metric, err := h.metricService.GetMetric(m.MType, m.ID)
+	metric, err := h.metricService.GetMetric(m.Key())
 
 	if err != nil {
 		logger.Log.Error("failed to get metric", zap.Error(err))
@@ -205,30 +492,307 @@ func (h *handler) GetMetric(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (h *handler) GetAllMetrics(w http.ResponseWriter, req *http.Request) {
+func (h *handler) DeleteMetric(w http.ResponseWriter, req *http.Request) {
+	key, err := metricKey(req, chi.URLParam(req, metricType))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = h.metricService.DeleteMetric(key); err != nil {
+		logger.Log.Error("failed to delete metric",
+			zap.String(metricType, key.MType),
+			zap.String(metricName, key.ID),
+			zap.Error(err),
+		)
+		handleGetMetricError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteMetrics удаляет метрики по тем же фильтрам, что и ListMetrics.
+// Без prefix, glob, regex или селектора меток запрос отклоняется, чтобы случайно не стереть всё.
+func (h *handler) DeleteMetrics(w http.ResponseWriter, req *http.Request) {
+	q, err := parseMetricQuery(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Prefix == "" && q.Glob == "" && q.Regex == nil && len(q.Labels) == 0 {
+		http.Error(w, "name pattern or label selector is required", http.StatusBadRequest)
+		return
+	}
+	deleted, err := h.metricService.DeleteMetrics(q)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Log.Error("failed to delete metrics", zap.Error(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(map[string]int{"deleted": deleted}); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) ResetCounter(w http.ResponseWriter, req *http.Request) {
+	key, err := metricKey(req, domain.Counter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metric, err := h.metricService.ResetCounter(key)
+	if err != nil {
+		logger.Log.Error("failed to reset counter", zap.String(metricName, key.ID), zap.Error(err))
+		handleGetMetricError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(metric); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) ListMetrics(w http.ResponseWriter, req *http.Request) {
+	q, err := parseMetricQuery(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.metricService.QueryMetrics(q)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Log.Error("failed to query metrics", zap.Error(err))
+		return
+	}
+	response := metricListResponse{Metrics: page.Metrics}
+	if page.HasMore {
+		response.NextCursor, err = encodeCursor(&page.Metrics[len(page.Metrics)-1], q.SortBy)
+		if err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			logger.Log.Error("failed to encode cursor", zap.Error(err))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) GetHistory(w http.ResponseWriter, req *http.Request) {
+	key, err := metricKey(req, chi.URLParam(req, metricType))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, step, err := parseHistoryQuery(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	samples, err := h.metricService.GetHistory(key, from, to, step)
+	if err != nil {
+		logger.Log.Error("failed to get history",
+			zap.String(metricType, key.MType),
+			zap.String(metricName, key.ID),
+			zap.Error(err),
+		)
+		if errors.Is(err, domain.ErrHistoryDisabled) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		handleGetMetricError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(historyResponse{ID: key.ID, MType: key.MType, Samples: samples}); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) QueryAggregate(w http.ResponseWriter, req *http.Request) {
+	key, err := metricKey(req, chi.URLParam(req, metricType))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fn, window, err := parseAggregateQuery(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.metricService.Aggregate(key, fn, window)
+	if err != nil {
+		logger.Log.Error("failed to aggregate metric",
+			zap.String(metricType, key.MType),
+			zap.String(metricName, key.ID),
+			zap.String("fn", string(fn)),
+			zap.Error(err),
+		)
+		switch {
+		case errors.Is(err, domain.ErrHistoryDisabled):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		case errors.Is(err, domain.ErrNotCounter) || errors.Is(err, domain.ErrNotGauge):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, domain.ErrNoSamples):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			handleGetMetricError(w, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) GetPrometheusMetrics(w http.ResponseWriter, req *http.Request) {
 	metrics, err := h.metricService.GetAllMetrics()
 	if err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
 		logger.Log.Error("failed to get all metrics", zap.Error(err))
 		return
 	}
-	html := "<html><body><ul>"
-	for _, metric := range metrics {
-		switch metric.MType {
-		case domain.Gauge:
-			if metric.Value != nil {
-				html += fmt.Sprintf("<li>mType: %s, mName: %s, Value %v", metric.MType, metric.ID, *metric.Value)
-			}
-		case domain.Counter:
-			if metric.Delta != nil {
-				html += fmt.Sprintf("<li>mType: %s, mName: %s, Value %v", metric.MType, metric.ID, *metric.Delta)
-			}
-		}
+	registry, err := h.metricService.GetAllMeta()
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Log.Error("failed to get metadata", zap.Error(err))
+		return
+	}
+	help := make(map[string]string, len(registry))
+	for name, meta := range registry {
+		help[name] = meta.Description
+	}
+	if len(h.limiters) > 0 {
+		metrics = append(metrics, h.throttledMetrics()...)
+		help[throttledMetric] = "Requests rejected by per-client rate limiting."
 	}
-	html += "</ul></body></html>"
-	w.Header().Set("Content-Type", "text/html")
-	if _, err := w.Write([]byte(html)); err != nil {
-		w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", prometheusContentType)
+	if err = writePrometheus(w, metrics, help); err != nil {
+		logger.Log.Error("failed to write prometheus metrics", zap.Error(err))
+		return
+	}
+}
+
+// throttledMetrics - собственные метрики сервера: сколько запросов отклонено в каждой группе маршрутов.
+func (h *handler) throttledMetrics() []domain.Metric {
+	metrics := make([]domain.Metric, 0, len(h.limiters))
+	for group, limiter := range h.limiters {
+		throttled := int64(limiter.Throttled())
+		metrics = append(metrics, domain.Metric{
+			ID:     throttledMetric,
+			MType:  domain.Counter,
+			Delta:  &throttled,
+			Labels: domain.Labels{"group": group},
+		})
+	}
+	return metrics
+}
+
+func (h *handler) ListAgents(w http.ResponseWriter, req *http.Request) {
+	agents, err := h.metricService.GetAgents()
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Log.Error("failed to get agents", zap.Error(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(agents); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) ListAlerts(w http.ResponseWriter, req *http.Request) {
+	alerts := make([]domain.Alert, 0)
+	if h.alerts != nil {
+		alerts = h.alerts.Alerts()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(alerts); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+// SetMeta регистрирует описание метрики. Имя берётся из пути, имя в теле, если есть, должно с ним совпадать.
+func (h *handler) SetMeta(w http.ResponseWriter, req *http.Request) {
+	name, err := pathParam(req, metricName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var meta domain.Meta
+	if err = json.NewDecoder(req.Body).Decode(&meta); err != nil {
+		logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if meta.Name != "" && meta.Name != name {
+		http.Error(w, "metadata name does not match path", http.StatusBadRequest)
+		return
+	}
+	meta.Name = name
+	if err = h.metricService.SetMeta(&meta); err != nil {
+		logger.Log.Error("failed to set metadata", zap.String(metricName, name), zap.Error(err))
+		handleSetMetricError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(meta); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) GetMeta(w http.ResponseWriter, req *http.Request) {
+	name, err := pathParam(req, metricName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	meta, err := h.metricService.GetMeta(name)
+	if err != nil {
+		logger.Log.Error("failed to get metadata", zap.String(metricName, name), zap.Error(err))
+		handleGetMetricError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(meta); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) ListMeta(w http.ResponseWriter, req *http.Request) {
+	registry, err := h.metricService.GetAllMeta()
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Log.Error("failed to get metadata", zap.Error(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(registry.List()); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+		return
+	}
+}
+
+func (h *handler) Ping(w http.ResponseWriter, req *http.Request) {
+	health := h.metricService.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if health.Status != domain.StatusOK {
+		logger.Log.Error("health check failed", zap.Any("checks", health.Checks))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
 		return
 	}
 }
@@ -1,20 +1,34 @@
 package rest
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 
 	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/file"
 	"metrics/internal/server/adapters/storage/memory"
 	"metrics/internal/server/config"
+	"metrics/internal/server/core/alerting"
 	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/files"
 	"metrics/internal/server/core/service"
 	"metrics/internal/server/logger"
 )
@@ -99,7 +113,7 @@ func TestHandler_SetMetricValueSuccess(t *testing.T) {
 			}()
 			assert.Equal(t, tt.want.statusCode, result.StatusCode)
 
-			value, _ := h.metricService.GetMetricValue(tt.metric.Type, tt.metric.Name)
+			value, _ := h.metricService.GetMetricValue(domain.Key{MType: tt.metric.Type, ID: tt.metric.Name})
 			assert.Equal(t, tt.metric.Value, value)
 		})
 	}
@@ -202,3 +216,1088 @@ func TestHandler_SetMetricValueFailed(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_SetMetrics(t *testing.T) {
+	type want struct {
+		statusCode int
+		body       string
+	}
+	tests := []struct {
+		name string
+		body string
+		want want
+	}{
+		{
+			name: "statusOkBatch",
+			body: `[{"id":"PollCount","type":"counter","delta":2},` +
+				`{"id":"Alloc","type":"gauge","value":1.5},` +
+				`{"id":"PollCount","type":"counter","delta":3}]`,
+			want: want{
+				statusCode: http.StatusOK,
+				body: `[{"id":"PollCount","type":"counter","delta":5},` +
+					`{"id":"Alloc","type":"gauge","value":1.5}]`,
+			},
+		},
+		{
+			name: "statusBadRequestEmptyBatch",
+			body: `[]`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "statusBadRequestMissingValue",
+			body: `[{"id":"Other","type":"gauge","value":1},{"id":"Alloc","type":"gauge"}]`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+	}
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString(tt.body))
+			r.Header.Set(agentIDHeader, "agent-1")
+			h := handler{
+				metricService: metricService,
+			}
+			h.SetMetrics(w, r)
+			result := w.Result()
+			defer func() {
+				err := result.Body.Close()
+				logger.Log.Error("error occurred during closing body", zap.Error(err))
+			}()
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			if tt.want.body != "" {
+				// Время записи у источника меняется от запуска к запуску, поэтому источник проверяется отдельно.
+				var metrics domain.MetricsList
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&metrics))
+				for i := range metrics {
+					if assert.NotNil(t, metrics[i].Source) {
+						assert.Equal(t, "agent-1", metrics[i].Source.AgentID)
+						assert.Equal(t, "192.0.2.1", metrics[i].Source.Address)
+					}
+					metrics[i].Source = nil
+				}
+				body, err := json.Marshal(metrics)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tt.want.body, string(body))
+			}
+		})
+	}
+	_, err = metricService.GetMetric(domain.Key{MType: domain.Gauge, ID: "Other"})
+	assert.ErrorIs(t, err, domain.ErrItemNotFound)
+}
+
+func TestHandler_Ping(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        storage.Config
+		statusCode int
+	}{
+		{
+			name:       "statusOkMemory",
+			cfg:        storage.Config{Memory: &memory.Config{}},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "statusOkFile",
+			cfg:        storage.Config{File: &file.Config{Filepath: filepath.Join(t.TempDir(), "metrics.json")}},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "statusErrorFile",
+			cfg:        storage.Config{File: &file.Config{Filepath: filepath.Join(t.TempDir(), "missing", "metrics.json")}},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metricStorage, err := storage.NewStorage(tt.cfg)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			h := handler{
+				metricService: metricService,
+			}
+			w := httptest.NewRecorder()
+			h.Ping(w, httptest.NewRequest(http.MethodGet, "/ping", http.NoBody))
+			result := w.Result()
+			defer func() {
+				err := result.Body.Close()
+				logger.Log.Error("error occurred during closing body", zap.Error(err))
+			}()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			var health domain.Health
+			assert.NoError(t, json.NewDecoder(result.Body).Decode(&health))
+			assert.Len(t, health.Checks, 1)
+		})
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	gauge, counter, other := 1.5, int64(7), 2.0
+	metrics := domain.MetricsList{
+		{ID: "PollCount", MType: domain.Counter, Delta: &counter},
+		{ID: "http.latency-ms", MType: domain.Gauge, Value: &gauge},
+		{ID: "9lives", MType: domain.Gauge, Value: &other},
+		{ID: "PollCount", MType: domain.Gauge, Value: &other},
+		{ID: "PollCount", MType: domain.Counter, Delta: &counter, Labels: domain.Labels{"host": `a"b`, "dc": "eu"}},
+		{ID: "latency", MType: domain.Histogram, Labels: domain.Labels{"host": "a"}, Histogram: &domain.HistogramData{
+			Bounds: []float64{1}, Counts: []uint64{2, 1}, Count: 3, Sum: 4.5,
+		}},
+	}
+	var buf bytes.Buffer
+	err := writePrometheus(&buf, metrics, map[string]string{"PollCount": "number of polls"})
+	assert.NoError(t, err)
+	assert.Equal(t, "# HELP PollCount number of polls\n# TYPE PollCount counter\nPollCount 7\n"+
+		"PollCount{dc=\"eu\",host=\"a\\\"b\"} 7\n"+
+		"# TYPE _9lives gauge\n_9lives 2\n"+
+		"# TYPE http_latency_ms gauge\nhttp_latency_ms 1.5\n"+
+		"# TYPE latency histogram\nlatency_bucket{host=\"a\",le=\"1\"} 2\nlatency_bucket{host=\"a\",le=\"+Inf\"} 3\n"+
+		"latency_sum{host=\"a\"} 4.5\nlatency_count{host=\"a\"} 3\n", buf.String())
+}
+
+func TestRouteGroup(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodPost, path: "/update/gauge/Alloc/1", want: updateGroup},
+		{method: http.MethodPost, path: "/updates/", want: updateGroup},
+		{method: http.MethodPost, path: "/write", want: updateGroup},
+		{method: http.MethodPost, path: "/value/", want: valueGroup},
+		{method: http.MethodGet, path: "/value/gauge/Alloc", want: valueGroup},
+		{method: http.MethodDelete, path: "/value/gauge/Alloc", want: updateGroup},
+		{method: http.MethodGet, path: "/", want: rootGroup},
+		{method: http.MethodGet, path: "/api/v1/metrics", want: rootGroup},
+		{method: http.MethodDelete, path: "/api/v1/metrics", want: updateGroup},
+		{method: http.MethodPost, path: "/reset/counter/PollCount", want: updateGroup},
+		{method: http.MethodPut, path: "/api/v1/meta/Alloc", want: updateGroup},
+		{method: http.MethodGet, path: "/ping", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, routeGroup(httptest.NewRequest(tt.method, tt.path, nil)))
+		})
+	}
+}
+
+func TestHandler_WriteInflux(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	h := handler{
+		metricService: metricService,
+	}
+	body := "cpu,host=a usage_idle=97.5,ctx=10i 1700000000000000000\n" +
+		"# comment\n" +
+		"cpu,host=b ctx=5i\n" +
+		"mem used=\"a lot\"\n" +
+		"disk\\ io,host=a reads=1.5\n" +
+		"cpu,host-name=c,k8s.pod=web,__name=x,le=1 ctx=1i\n" +
+		"cpu,host-name=a,host_name=b ctx=1i\n"
+	w := httptest.NewRecorder()
+	h.WriteInflux(w, httptest.NewRequest(http.MethodPost, "/write", bytes.NewBufferString(body)))
+	result := w.Result()
+	defer func() {
+		err := result.Body.Close()
+		logger.Log.Error("error occurred during closing body", zap.Error(err))
+	}()
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+	var response influxWriteResult
+	assert.NoError(t, json.NewDecoder(result.Body).Decode(&response))
+	if assert.Len(t, response.Errors, 2) {
+		assert.Equal(t, 4, response.Errors[0].Line)
+		assert.Equal(t, 7, response.Errors[1].Line)
+		assert.Contains(t, response.Errors[1].Error, domain.ErrIncorrectLabels.Error())
+	}
+
+	// Серии с разными тегами хранятся раздельно.
+	value, err := metricService.GetMetricValue(domain.Key{MType: domain.Counter, ID: "cpu_ctx", Labels: "host=a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "10", value)
+	value, err = metricService.GetMetricValue(domain.Key{MType: domain.Counter, ID: "cpu_ctx", Labels: "host=b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "5", value)
+	value, err = metricService.GetMetricValue(domain.Key{MType: domain.Gauge, ID: "cpu_usage_idle", Labels: "host=a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "97.5", value)
+	value, err = metricService.GetMetricValue(domain.Key{MType: domain.Gauge, ID: "disk io_reads", Labels: "host=a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5", value)
+	// Ключи тегов Telegraf вроде host-name и k8s.pod приводятся к допустимым именам меток.
+	value, err = metricService.GetMetricValue(domain.Key{
+		MType:  domain.Counter,
+		ID:     "cpu_ctx",
+		Labels: "host_name=c,k8s_pod=web,tag___name=x,tag_le=1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
+
+func TestHandler_ListMetrics(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, v := range []string{"HeapAlloc:5", "HeapIdle:1", "HeapSys:3", "Alloc:4", "HeapInuse:2"} {
+		id, value, _ := strings.Cut(v, ":")
+		_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: id, MType: domain.Gauge, Value: value})
+		assert.NoError(t, err)
+	}
+	_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: "HeapCount", MType: domain.Counter, Value: "9"})
+	assert.NoError(t, err)
+	h := handler{
+		metricService: metricService,
+	}
+
+	var ids []string
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		w := httptest.NewRecorder()
+		h.ListMetrics(w, httptest.NewRequest(http.MethodGet,
+			"/api/v1/metrics?type=gauge&prefix=Heap&sort=value&order=desc&limit=2&cursor="+cursor, http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response metricListResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		for _, m := range response.Metrics {
+			ids = append(ids, m.ID)
+		}
+		if response.NextCursor == "" {
+			break
+		}
+		// Курсор хранит только ключ сортировки, без источника и прочих полей метрики.
+		data, err := base64.RawURLEncoding.DecodeString(response.NextCursor)
+		assert.NoError(t, err)
+		var fields map[string]any
+		assert.NoError(t, json.Unmarshal(data, &fields))
+		assert.Len(t, fields, 3)
+		assert.Contains(t, fields, "v")
+		cursor = response.NextCursor
+	}
+	assert.Equal(t, []string{"HeapAlloc", "HeapSys", "HeapInuse", "HeapIdle"}, ids)
+
+	w := httptest.NewRecorder()
+	h.ListMetrics(w, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?regex=(", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_DeleteAndReset(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	cfg := &config.Config{FileStoragePath: filePath}
+	metricStorage, err := storage.NewStorage(storage.Config{
+		File: &file.Config{Filepath: filePath},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(cfg, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, id := range []string{"HeapAlloc", "HeapSys", "Alloc"} {
+		_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: id, MType: domain.Gauge, Value: "1"})
+		assert.NoError(t, err)
+	}
+	_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: "PollCount", MType: domain.Counter, Value: "5"})
+	assert.NoError(t, err)
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Delete("/value/{metricType}/{metricName}", h.DeleteMetric)
+	r.Delete("/api/v1/metrics", h.DeleteMetrics)
+	r.Post("/reset/counter/{metricName}", h.ResetCounter)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		statusCode int
+	}{
+		{name: "deleteOne", method: http.MethodDelete, url: "/value/gauge/Alloc", statusCode: http.StatusOK},
+		{name: "deleteMissing", method: http.MethodDelete, url: "/value/gauge/Alloc", statusCode: http.StatusNotFound},
+		{name: "deleteWithoutPattern", method: http.MethodDelete, url: "/api/v1/metrics", statusCode: http.StatusBadRequest},
+		{name: "deleteByGlob", method: http.MethodDelete, url: "/api/v1/metrics?glob=Heap*", statusCode: http.StatusOK},
+		{name: "resetCounter", method: http.MethodPost, url: "/reset/counter/PollCount", statusCode: http.StatusOK},
+		{name: "resetMissing", method: http.MethodPost, url: "/reset/counter/Missing", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, http.NoBody))
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+
+	restored, _, err := files.LoadMetricsFromFile(filePath)
+	assert.NoError(t, err)
+	assert.Len(t, restored, 1)
+	counter, found := restored[domain.Key{MType: domain.Counter, ID: "PollCount"}]
+	assert.True(t, found)
+	if assert.NotNil(t, counter.Delta) {
+		assert.Equal(t, int64(0), *counter.Delta)
+	}
+	assert.False(t, counter.Updated.IsZero())
+}
+
+func TestHandler_GetHistory(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{Retention: domain.Retention{Size: 3, MaxAge: time.Hour}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, value := range []string{"1", "2", "3", "4"} {
+		_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: "Alloc", MType: domain.Gauge, Value: value})
+		assert.NoError(t, err)
+	}
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Get("/api/v1/history/{metricType}/{metricName}", h.GetHistory)
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+		values     []float64
+	}{
+		{name: "all", url: "/api/v1/history/gauge/Alloc", statusCode: http.StatusOK, values: []float64{2, 3, 4}},
+		{name: "fromFuture", url: "/api/v1/history/gauge/Alloc?from=" +
+			strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10), statusCode: http.StatusOK, values: []float64{}},
+		{name: "badStep", url: "/api/v1/history/gauge/Alloc?step=fast", statusCode: http.StatusBadRequest},
+		{name: "badRange", url: "/api/v1/history/gauge/Alloc?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z",
+			statusCode: http.StatusBadRequest},
+		{name: "missing", url: "/api/v1/history/gauge/Missing", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, http.NoBody))
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var response historyResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			values := make([]float64, 0, len(response.Samples))
+			for _, s := range response.Samples {
+				values = append(values, s.Value)
+			}
+			assert.Equal(t, tt.values, values)
+		})
+	}
+}
+
+func TestHandler_QueryAggregate(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{Retention: domain.Retention{Size: 10, MaxAge: time.Hour}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	now := time.Now()
+	history := func(values map[time.Duration]float64, ages ...time.Duration) *domain.History {
+		h := domain.NewHistory(10)
+		for _, age := range ages {
+			h.Add(domain.Sample{Timestamp: now.Add(-age), Value: values[age]})
+		}
+		return h
+	}
+	// Счётчик сбрасывается между 4 и 2 минутами назад.
+	counter := map[time.Duration]float64{10 * time.Minute: 12, 4 * time.Minute: 15, 2 * time.Minute: 3, time.Minute: 5}
+	gauge := map[time.Duration]float64{10 * time.Minute: 100, 3 * time.Minute: 2, time.Minute: 4}
+	delta, value := int64(5), 4.0
+	assert.NoError(t, metricStorage.Restore(domain.MetricValues{
+		{MType: domain.Counter, ID: "PollCount"}: {Delta: &delta, Updated: now.Add(-time.Minute), History: history(counter,
+			10*time.Minute, 4*time.Minute, 2*time.Minute, time.Minute)},
+		{MType: domain.Gauge, ID: "Alloc"}: {Value: &value, Updated: now.Add(-time.Minute), History: history(gauge,
+			10*time.Minute, 3*time.Minute, time.Minute)},
+	}, nil))
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Get("/api/v1/query/{metricType}/{metricName}", h.QueryAggregate)
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+		value      float64
+		samples    int
+	}{
+		// Прирост считается от последнего значения до окна: 15-12, сброс до 3, 5-3.
+		{name: "increaseWithReset", url: "/api/v1/query/counter/PollCount?fn=increase&window=5m",
+			statusCode: http.StatusOK, value: 8, samples: 3},
+		{name: "rate", url: "/api/v1/query/counter/PollCount?fn=rate&window=5m",
+			statusCode: http.StatusOK, value: 8.0 / 300, samples: 3},
+		{name: "increaseSingleSample", url: "/api/v1/query/counter/PollCount?fn=increase&window=90s",
+			statusCode: http.StatusOK, value: 2, samples: 1},
+		{name: "increaseEmptyWindow", url: "/api/v1/query/counter/PollCount?fn=increase&window=30s",
+			statusCode: http.StatusOK, value: 0, samples: 0},
+		{name: "increaseWholeHistory", url: "/api/v1/query/counter/PollCount?fn=increase&window=1h",
+			statusCode: http.StatusOK, value: 8, samples: 4},
+		{name: "avg", url: "/api/v1/query/gauge/Alloc?fn=avg&window=5m", statusCode: http.StatusOK, value: 3, samples: 2},
+		{name: "min", url: "/api/v1/query/gauge/Alloc?fn=min&window=1h", statusCode: http.StatusOK, value: 2, samples: 3},
+		{name: "lastEmptyWindow", url: "/api/v1/query/gauge/Alloc?fn=last&window=30s", statusCode: http.StatusNotFound},
+		{name: "sumOfCounter", url: "/api/v1/query/counter/PollCount?fn=sum&window=5m", statusCode: http.StatusBadRequest},
+		{name: "rateOfGauge", url: "/api/v1/query/gauge/Alloc?fn=rate&window=5m", statusCode: http.StatusBadRequest},
+		{name: "badWindow", url: "/api/v1/query/gauge/Alloc?fn=avg&window=-1m", statusCode: http.StatusBadRequest},
+		{name: "unknownFn", url: "/api/v1/query/gauge/Alloc?fn=median&window=1m", statusCode: http.StatusBadRequest},
+		{name: "missing", url: "/api/v1/query/gauge/Missing?fn=avg&window=1m", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, http.NoBody))
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var result domain.AggregateResult
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+			assert.InDelta(t, tt.value, result.Value, 1e-9)
+			assert.Equal(t, tt.samples, result.Samples)
+		})
+	}
+}
+
+// С настройками по умолчанию сервис сам хранит историю, нужную запросам вроде rate за 5m.
+func TestHandler_QueryAggregateDefaultConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "metrics.json")
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{Retention: cfg.Retention()},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(cfg, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: "PollCount", MType: domain.Counter, Value: "5"})
+		assert.NoError(t, err)
+	}
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Get("/api/v1/query/{metricType}/{metricName}", h.QueryAggregate)
+	w := httptest.NewRecorder()
+	target := "/api/v1/query/counter/PollCount?fn=increase&window=5m"
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result domain.AggregateResult
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal(t, 3, result.Samples)
+	assert.InDelta(t, 10, result.Value, 1e-9)
+}
+
+func TestAPI_Stream(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	api, err := NewAPI(metricService, nil, &config.Config{Key: "secret"}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ts := httptest.NewUnstartedServer(api.srv.Handler)
+	ts.Config.WriteTimeout = api.srv.WriteTimeout
+	ts.Start()
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/stream?type=gauge&prefix=Heap", http.NoBody)
+	assert.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	events := bufio.NewScanner(zr)
+
+	// Событие после общего WriteTimeout должно дойти до клиента.
+	time.Sleep(api.srv.WriteTimeout + 200*time.Millisecond)
+	for _, m := range []string{"Alloc", "HeapAlloc"} {
+		_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: m, MType: domain.Gauge, Value: "3"})
+		assert.NoError(t, err)
+	}
+	_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: "HeapCount", MType: domain.Counter, Value: "1"})
+	assert.NoError(t, err)
+	_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: "HeapSys", MType: domain.Gauge, Value: "4"})
+	assert.NoError(t, err)
+
+	var received []string
+	for len(received) < 2 && events.Scan() {
+		data, found := strings.CutPrefix(events.Text(), "data: ")
+		if !found {
+			continue
+		}
+		var m domain.Metric
+		assert.NoError(t, json.Unmarshal([]byte(data), &m))
+		received = append(received, m.ID)
+	}
+	assert.Equal(t, []string{"HeapAlloc", "HeapSys"}, received)
+}
+
+func TestHandler_Dashboard(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, m := range []domain.SetMetricRequest{
+		{ID: "Zeta", MType: domain.Gauge, Value: "1.5"},
+		{ID: "Alpha", MType: domain.Gauge, Value: "2"},
+		{ID: "PollCount", MType: domain.Counter, Value: "7"},
+		{ID: `<script>alert("x")</script>`, MType: domain.Gauge, Value: "3"},
+	} {
+		_, err = metricService.SetMetricValue(&m)
+		assert.NoError(t, err)
+	}
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Get("/", h.GetAllMetrics)
+	r.Get("/view/{metricType}/{metricName}", h.ViewMetric)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.NotContains(t, body, `<script>alert`)
+	assert.Contains(t, body, `&lt;script&gt;alert`)
+	counter, gauge := strings.Index(body, "<h2>counter</h2>"), strings.Index(body, "<h2>gauge</h2>")
+	alpha, zeta := strings.Index(body, ">Alpha<"), strings.Index(body, ">Zeta<")
+	assert.True(t, counter >= 0 && counter < gauge, "counters go before gauges")
+	assert.True(t, gauge < alpha && alpha < zeta, "gauges are sorted by name")
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+		contains   string
+	}{
+		{name: "gauge", url: "/view/gauge/Zeta", statusCode: http.StatusOK, contains: "1.5"},
+		{name: "escapedName", url: "/view/gauge/" + url.PathEscape(`<script>alert("x")</script>`),
+			statusCode: http.StatusOK, contains: "&lt;script&gt;"},
+		{name: "missing", url: "/view/counter/Zeta", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, http.NoBody))
+			assert.Equal(t, tt.statusCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.contains)
+			assert.NotContains(t, w.Body.String(), "<script>alert")
+		})
+	}
+}
+
+func TestHandler_Labels(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	metricStorage, err := storage.NewStorage(storage.Config{
+		File: &file.Config{Filepath: filePath},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{FileStoragePath: filePath}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Post("/update/", h.SetMetric)
+	r.Post("/updates/", h.SetMetrics)
+	r.Get("/value/{metricType}/{metricName}", h.GetMetricValue)
+	r.Get("/api/v1/metrics", h.ListMetrics)
+
+	// Источник записи содержит время, поэтому из сравниваемых ответов он вырезается.
+	source := regexp.MustCompile(`,"source":\{[^}]*\}`)
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+		response   string
+	}{
+		{name: "unlabeled", method: http.MethodPost, url: "/update/",
+			body: `{"id":"Alloc","type":"gauge","value":1}`, statusCode: http.StatusOK},
+		{name: "batch", method: http.MethodPost, url: "/updates/", body: `[
+			{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"a"}},
+			{"id":"Alloc","type":"gauge","value":3,"labels":{"host":"b","dc":"eu"}},
+			{"id":"PollCount","type":"counter","delta":1,"labels":{"host":"a"}}
+		]`, statusCode: http.StatusOK},
+		{name: "badLabelName", method: http.MethodPost, url: "/update/",
+			body: `{"id":"Alloc","type":"gauge","value":1,"labels":{"bad-name":"x"}}`, statusCode: http.StatusBadRequest},
+		{name: "valueUnlabeled", method: http.MethodGet, url: "/value/gauge/Alloc", statusCode: http.StatusOK, response: "1"},
+		{name: "valueLabeled", method: http.MethodGet, url: "/value/gauge/Alloc?labels=" + url.QueryEscape("dc=eu,host=b"),
+			statusCode: http.StatusOK, response: "3"},
+		{name: "valueMissingLabels", method: http.MethodGet, url: "/value/gauge/Alloc?labels=host%3Dc",
+			statusCode: http.StatusNotFound},
+		{name: "selectByLabel", method: http.MethodGet, url: "/api/v1/metrics?label=host%3Da", statusCode: http.StatusOK,
+			response: `{"metrics":[{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"a"}},` +
+				`{"id":"PollCount","type":"counter","delta":1,"labels":{"host":"a"}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.response != "" {
+				body := source.ReplaceAllString(strings.TrimSpace(w.Body.String()), "")
+				assert.Equal(t, tt.response, body)
+			}
+		})
+	}
+
+	assert.NoError(t, metricService.SaveMetricsToFile())
+	restored, _, err := files.LoadMetricsFromFile(filePath)
+	assert.NoError(t, err)
+	assert.Len(t, restored, 4)
+	value, found := restored[domain.Key{MType: domain.Gauge, ID: "Alloc", Labels: "dc=eu,host=b"}]
+	if assert.True(t, found) {
+		assert.Equal(t, domain.Labels{"host": "b", "dc": "eu"}, value.Labels)
+	}
+}
+
+func TestHandler_Histogram(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	metricStorage, err := storage.NewStorage(storage.Config{
+		File: &file.Config{Filepath: filePath},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{FileStoragePath: filePath}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Post("/update/", h.SetMetric)
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+	r.Post("/updates/", h.SetMetrics)
+	r.Get("/value/{metricType}/{metricName}", h.GetMetricValue)
+	r.Get("/", h.GetAllMetrics)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+	}{
+		{name: "configure", method: http.MethodPost, url: "/update/",
+			body: `{"id":"latency","type":"histogram","value":0.05,"histogram":{"bounds":[0.1,1]}}`, statusCode: http.StatusOK},
+		{name: "observe", method: http.MethodPost, url: "/update/histogram/latency/2", statusCode: http.StatusOK},
+		{name: "merge", method: http.MethodPost, url: "/updates/",
+			body:       `[{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,3,0],"count":4,"sum":1.5}}]`,
+			statusCode: http.StatusOK},
+		{name: "otherBounds", method: http.MethodPost, url: "/update/",
+			body: `{"id":"latency","type":"histogram","value":1,"histogram":{"bounds":[5]}}`, statusCode: http.StatusBadRequest},
+		{name: "badCounts", method: http.MethodPost, url: "/updates/",
+			body:       `[{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1],"count":1}}]`,
+			statusCode: http.StatusBadRequest},
+		{name: "noValue", method: http.MethodPost, url: "/update/",
+			body: `{"id":"latency","type":"histogram"}`, statusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/value/histogram/latency", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"count":6,"sum":3.55,"buckets":[{"le":"0.1","count":2},{"le":"1","count":3},{"le":"+Inf","count":1}]}`,
+		w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Contains(t, w.Body.String(), "count 6, sum 3.55; ≤0.1: 2 ≤1: 3 ≤")
+
+	assert.NoError(t, metricService.SaveMetricsToFile())
+	restored, _, err := files.LoadMetricsFromFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, &domain.HistogramData{Bounds: []float64{0.1, 1}, Counts: []uint64{2, 3, 1}, Count: 6, Sum: 3.55},
+		restored[domain.Key{MType: domain.Histogram, ID: "latency"}].Histogram)
+}
+
+func TestHandler_Summary(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	metricStorage, err := storage.NewStorage(storage.Config{
+		File: &file.Config{Filepath: filePath},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{FileStoragePath: filePath}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+	r.Post("/updates/", h.SetMetrics)
+	r.Get("/api/v1/quantiles/{metricName}", h.GetQuantiles)
+
+	// Половина значений приходит по одному, половина - готовым скетчем от другого агента.
+	agent := domain.NewSketch(domain.DefaultSketchAccuracy)
+	for v := 1; v <= 100; v++ {
+		if v%2 == 0 {
+			agent.Add(float64(v))
+			continue
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/update/summary/rt/"+strconv.Itoa(v), http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	batch, err := json.Marshal(domain.MetricsList{{ID: "rt", MType: domain.Summary, Summary: agent}})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(batch)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/",
+		strings.NewReader(`[{"id":"rt","type":"summary","summary":{"alpha":0.05,"zero":1,"count":1}}]`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "sketches with other accuracy are not mergeable")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/quantiles/rt?q=0.5,0.99", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result domain.QuantileResult
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal(t, uint64(100), result.Count)
+	assert.InDelta(t, 5050, result.Sum, 1e-9)
+	if assert.Len(t, result.Quantiles, 2) {
+		assert.InEpsilon(t, 50, result.Quantiles[0].Value, domain.DefaultSketchAccuracy)
+		assert.InEpsilon(t, 99, result.Quantiles[1].Value, domain.DefaultSketchAccuracy)
+	}
+
+	for _, endpoint := range []string{"/api/v1/quantiles/rt?q=2", "/api/v1/quantiles/missing"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, endpoint, http.NoBody))
+		assert.NotEqual(t, http.StatusOK, w.Code, endpoint)
+	}
+
+	assert.NoError(t, metricService.SaveMetricsToFile())
+	restored, _, err := files.LoadMetricsFromFile(filePath)
+	assert.NoError(t, err)
+	stored, err := metricService.GetMetric(domain.Key{MType: domain.Summary, ID: "rt"})
+	assert.NoError(t, err)
+	assert.Equal(t, stored.Summary, restored[domain.Key{MType: domain.Summary, ID: "rt"}].Summary)
+}
+
+func TestHandler_Meta(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	// Снапшот в старом формате - массив метрик без реестра.
+	assert.NoError(t, os.WriteFile(filePath, []byte(`[{"id":"Alloc","type":"gauge","value":1}]`), 0o600))
+	newRouter := func() (*chi.Mux, *service.MetricService) {
+		metricStorage, err := storage.NewStorage(storage.Config{
+			File: &file.Config{Filepath: filePath},
+		})
+		assert.NoError(t, err)
+		metricService, err := service.NewMetricService(&config.Config{
+			FileStoragePath: filePath,
+			Restore:         true,
+			StrictMeta:      true,
+		}, metricStorage)
+		assert.NoError(t, err)
+		r := chi.NewRouter()
+		h := handler{
+			metricService: metricService,
+		}
+		r.Post("/update/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+		r.Put("/api/v1/meta/{metricName}", h.SetMeta)
+		r.Get("/api/v1/meta/{metricName}", h.GetMeta)
+		r.Get("/metrics", h.GetPrometheusMetrics)
+		r.Get("/", h.GetAllMetrics)
+		return r, metricService
+	}
+	r, _ := newRouter()
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+	}{
+		{name: "unregistered", method: http.MethodPost, url: "/update/gauge/Alloc/2", statusCode: http.StatusBadRequest},
+		{name: "register", method: http.MethodPut, url: "/api/v1/meta/Alloc",
+			body: `{"type":"gauge","unit":"bytes","description":"Allocated heap","min":0}`, statusCode: http.StatusOK},
+		{name: "registered", method: http.MethodPost, url: "/update/gauge/Alloc/2", statusCode: http.StatusOK},
+		{name: "belowRange", method: http.MethodPost, url: "/update/gauge/Alloc/-1", statusCode: http.StatusBadRequest},
+		{name: "wrongType", method: http.MethodPost, url: "/update/counter/Alloc/1", statusCode: http.StatusBadRequest},
+		{name: "unknownType", method: http.MethodPut, url: "/api/v1/meta/Bad", body: `{"type":"meter"}`, statusCode: http.StatusBadRequest},
+		{name: "badRange", method: http.MethodPut, url: "/api/v1/meta/Bad",
+			body: `{"type":"gauge","min":2,"max":1}`, statusCode: http.StatusBadRequest},
+		{name: "nameMismatch", method: http.MethodPut, url: "/api/v1/meta/Bad",
+			body: `{"name":"Other","type":"gauge"}`, statusCode: http.StatusBadRequest},
+		{name: "getMissing", method: http.MethodGet, url: "/api/v1/meta/Bad", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.statusCode, w.Code, w.Body.String())
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Contains(t, w.Body.String(), "# HELP Alloc Allocated heap\n# TYPE Alloc gauge\nAlloc 2\n")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Contains(t, w.Body.String(), "<td>bytes</td><td class=\"muted\">Allocated heap</td>")
+
+	// Реестр сохраняется вместе со снапшотом и восстанавливается после перезапуска.
+	r, _ = newRouter()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/meta/Alloc", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var meta domain.Meta
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&meta))
+	assert.Equal(t, "bytes", meta.Unit)
+	if assert.NotNil(t, meta.Min) {
+		assert.Equal(t, 0.0, *meta.Min)
+	}
+}
+
+func TestHandler_Agents(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r := chi.NewRouter()
+	h := handler{
+		metricService: metricService,
+	}
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+	r.Post("/update/", h.SetMetric)
+	r.Post("/value/", h.GetMetric)
+	r.Get("/api/v1/agents", h.ListAgents)
+
+	writes := []struct {
+		agentID    string
+		remoteAddr string
+		url        string
+		body       string
+	}{
+		{agentID: "web-1", remoteAddr: "10.0.0.1:51000", url: "/update/gauge/Alloc/1"},
+		{agentID: "web-1", remoteAddr: "10.0.0.1:51001", url: "/update/counter/PollCount/1"},
+		{remoteAddr: "10.0.0.2:40000", url: "/update/gauge/Load/1"},
+		// Подмена источника в теле запроса не проходит: сервер записывает фактического отправителя.
+		{agentID: "web-2", remoteAddr: "10.0.0.3:40000", url: "/update/",
+			body: `{"id":"PollCount","type":"counter","delta":1,"source":{"agent_id":"web-1"}}`},
+	}
+	for _, write := range writes {
+		req := httptest.NewRequest(http.MethodPost, write.url, strings.NewReader(write.body))
+		req.RemoteAddr = write.remoteAddr
+		if write.agentID != "" {
+			req.Header.Set(agentIDHeader, write.agentID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, write.url)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/value/", strings.NewReader(`{"id":"Alloc","type":"gauge"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var metric domain.Metric
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&metric))
+	if assert.NotNil(t, metric.Source) {
+		assert.Equal(t, "web-1", metric.Source.AgentID)
+		assert.Equal(t, "10.0.0.1", metric.Source.Address)
+		assert.False(t, metric.Source.Timestamp.IsZero())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/agents", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var agents []domain.Agent
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&agents))
+	if assert.Len(t, agents, 3) {
+		assert.Equal(t, "10.0.0.2", agents[0].ID)
+		assert.Equal(t, []domain.AgentMetric{{ID: "Load", MType: domain.Gauge}}, agents[0].Metrics)
+		assert.Equal(t, "web-1", agents[1].ID)
+		assert.Equal(t, []domain.AgentMetric{{ID: "Alloc", MType: domain.Gauge}}, agents[1].Metrics)
+		assert.Equal(t, "web-2", agents[2].ID)
+		assert.Equal(t, "10.0.0.3", agents[2].Address)
+		assert.Equal(t, []domain.AgentMetric{{ID: "PollCount", MType: domain.Counter}}, agents[2].Metrics)
+		assert.False(t, agents[2].LastSeen.IsZero())
+	}
+}
+
+func TestHandler_Alerts(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rules, err := alerting.ParseRules(strings.NewReader(`{"rules": [
+		{"name": "heap", "type": "gauge", "metric": "Heap*", "op": ">", "threshold": 100, "for": "1m"}
+	]}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	engine := alerting.NewEngine(rules, metricService, nil, time.Minute)
+	for _, v := range []string{"HeapInuse:500", "HeapIdle:50", "Alloc:500"} {
+		id, value, _ := strings.Cut(v, ":")
+		_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: id, MType: domain.Gauge, Value: value})
+		assert.NoError(t, err)
+	}
+
+	list := func(h *handler) []domain.Alert {
+		w := httptest.NewRecorder()
+		h.ListAlerts(w, httptest.NewRequest(http.MethodGet, "/api/v1/alerts", http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var alerts []domain.Alert
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&alerts))
+		return alerts
+	}
+	// Без движка алертинга отдаётся пустой список, а не null.
+	assert.Equal(t, []domain.Alert{}, list(&handler{metricService: metricService}))
+
+	h := &handler{metricService: metricService, alerts: engine}
+	start := time.Now()
+	engine.Evaluate(start)
+	alerts := list(h)
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, "HeapInuse", alerts[0].ID)
+		assert.Equal(t, domain.AlertPending, alerts[0].State)
+	}
+	engine.Evaluate(start.Add(time.Minute))
+	alerts = list(h)
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, domain.AlertFiring, alerts[0].State)
+		assert.InDelta(t, 500, alerts[0].Value, 1e-9)
+	}
+
+	// Разрешённые срабатывания в списке активных не показываются.
+	_, err = metricService.SetMetricValue(&domain.SetMetricRequest{ID: "HeapInuse", MType: domain.Gauge, Value: "10"})
+	assert.NoError(t, err)
+	engine.Evaluate(start.Add(2 * time.Minute))
+	assert.Empty(t, list(h))
+}
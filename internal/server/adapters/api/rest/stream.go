@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	streamHeartbeat    = 15 * time.Second
+	streamWriteTimeout = time.Second
+)
+
+// Stream отправляет изменения метрик как Server-Sent Events.
+// Общий WriteTimeout сервера снимается, вместо него на каждое событие ставится свой дедлайн.
+func (h *handler) Stream(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseMetricFilter(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc := http.NewResponseController(w)
+	if err = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+		logger.Log.Error("streaming is not supported", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	updates, unsubscribe := h.metricService.Subscribe(filter)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	send := func(event string) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			logger.Log.Error("failed to set write deadline", zap.Error(err))
+			return false
+		}
+		if _, err := fmt.Fprint(w, event); err != nil {
+			logger.Log.Info("stream client gone", zap.Error(err))
+			return false
+		}
+		if err := rc.Flush(); err != nil {
+			logger.Log.Info("stream client gone", zap.Error(err))
+			return false
+		}
+		return true
+	}
+	if !send(": connected\n\n") {
+		return
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-h.shutdown:
+			return
+		case <-heartbeat.C:
+			if !send(": heartbeat\n\n") {
+				return
+			}
+		case m, ok := <-updates:
+			if !ok {
+				send("event: overflow\ndata: subscriber is too slow\n\n")
+				return
+			}
+			if !send(metricEvent(&m)) {
+				return
+			}
+		}
+	}
+}
+
+func metricEvent(m *domain.Metric) string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		logger.Log.Error("error encoding metric event", zap.Error(err))
+		return ""
+	}
+	return "event: metric\ndata: " + string(data) + "\n\n"
+}
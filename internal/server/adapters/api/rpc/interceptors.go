@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"metrics/internal/server/logger"
+	"metrics/internal/shared-kernel/hash"
+	"metrics/internal/shared-kernel/pb"
+)
+
+func loggingInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logger.Log.Info("got incoming grpc request",
+		zap.String("method", info.FullMethod),
+		zap.String("code", status.Code(err).String()),
+		zap.String("duration", time.Since(start).String()),
+	)
+	return resp, err
+}
+
+func isWrite(method string) bool {
+	return method == pb.Metrics_SetMetric_FullMethodName || method == pb.Metrics_SetMetrics_FullMethodName
+}
+
+// signInterceptor повторяет middleware.SignMiddleware: подпись HMAC-SHA256 запроса передаётся в метаданных hashsha256.
+// Запись без подписи отклоняется, у чтения подпись проверяется, только если она передана.
+func signInterceptor(key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if key == "" {
+			return handler(ctx, req)
+		}
+		signature := metadataValue(ctx, hash.MetadataKey)
+		if signature != "" || isWrite(info.FullMethod) {
+			if err := checkSignature(key, req, signature); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// signStreamInterceptor проверяет подпись каждого сообщения потока, если клиент её передал.
+func signStreamInterceptor(key string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if key == "" {
+			return handler(srv, ss)
+		}
+		signature := metadataValue(ss.Context(), hash.MetadataKey)
+		if signature == "" {
+			return handler(srv, ss)
+		}
+		return handler(srv, &signedStream{ServerStream: ss, key: key, signature: signature})
+	}
+}
+
+type signedStream struct {
+	grpc.ServerStream
+	key       string
+	signature string
+}
+
+// RecvMsg не оборачивает ошибку получения: обработчики потоков сравнивают её с io.EOF.
+func (s *signedStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		err = checkSignature(s.key, m, s.signature)
+	}
+	return err
+}
+
+func checkSignature(key string, req any, signature string) error {
+	msg, ok := req.(proto.Message)
+	if !ok || !hash.VerifyMessage(key, msg, signature) {
+		logger.Log.Info("grpc request signature mismatch")
+		return status.Error(codes.Unauthenticated, "invalid signature")
+	}
+	return nil
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// trustedSubnetInterceptor повторяет middleware.TrustedSubnetMiddleware:
+// адрес агента берётся из метаданных x-real-ip.
+func trustedSubnetInterceptor(subnet *net.IPNet, trustedReads bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if isWrite(info.FullMethod) || trustedReads {
+			if err := checkTrusted(ctx, subnet); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func trustedSubnetStreamInterceptor(subnet *net.IPNet, trustedReads bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if trustedReads {
+			if err := checkTrusted(ss.Context(), subnet); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkTrusted(ctx context.Context, subnet *net.IPNet) error {
+	if subnet == nil {
+		return nil
+	}
+	ip := net.ParseIP(metadataValue(ctx, "x-real-ip"))
+	if ip == nil || !subnet.Contains(ip) {
+		return status.Error(codes.PermissionDenied, "untrusted address")
+	}
+	return nil
+}
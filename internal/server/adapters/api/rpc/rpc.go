@@ -0,0 +1,243 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // регистрирует gzip-компрессор для входящих вызовов
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+	"metrics/internal/shared-kernel/pb"
+)
+
+type MetricService interface {
+	GetMetric(key domain.Key) (*domain.Metric, error)
+	SetMetric(m *domain.Metric) (*domain.Metric, error)
+	SetMetrics(metrics domain.MetricsList) (domain.MetricsList, error)
+	GetAllMetrics() (domain.MetricsList, error)
+}
+
+type handler struct {
+	pb.UnimplementedMetricsServer
+	metricService MetricService
+}
+
+type Server struct {
+	srv    *grpc.Server
+	listen net.Listener
+}
+
+func NewServer(metricService MetricService, cfg *config.Config) (*Server, error) {
+	var subnet *net.IPNet
+	if cfg.TrustedSubnet != "" {
+		_, network, err := net.ParseCIDR(cfg.TrustedSubnet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trusted subnet: %w", err)
+		}
+		subnet = network
+	}
+	// Адрес занимается сразу, чтобы занятый порт останавливал запуск сервера.
+	listen, err := net.Listen("tcp", cfg.GRPCAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen grpc address: %w", err)
+	}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			loggingInterceptor,
+			trustedSubnetInterceptor(subnet, cfg.TrustedReads),
+			signInterceptor(cfg.Key),
+		),
+		grpc.ChainStreamInterceptor(
+			trustedSubnetStreamInterceptor(subnet, cfg.TrustedReads),
+			signStreamInterceptor(cfg.Key),
+		),
+	)
+	pb.RegisterMetricsServer(srv, &handler{metricService: metricService})
+	return &Server{
+		srv:    srv,
+		listen: listen,
+	}, nil
+}
+
+func (s *Server) Run() error {
+	if err := s.srv.Serve(s.listen); err != nil {
+		return fmt.Errorf("failed run grpc server: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) Stop() {
+	s.srv.GracefulStop()
+}
+
+func (h *handler) GetMetric(_ context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	key := domain.Key{MType: req.GetType(), ID: req.GetId(), Labels: domain.Labels(req.GetLabels()).String()}
+	metric, err := h.metricService.GetMetric(key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.GetMetricResponse{Metric: toProto(metric)}, nil
+}
+
+func (h *handler) SetMetric(ctx context.Context, req *pb.SetMetricRequest) (*pb.SetMetricResponse, error) {
+	if req.GetMetric() == nil {
+		return nil, status.Error(codes.InvalidArgument, "metric is required")
+	}
+	m := fromProto(req.GetMetric())
+	m.Source = contextSource(ctx)
+	metric, err := h.metricService.SetMetric(&m)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.SetMetricResponse{Metric: toProto(metric)}, nil
+}
+
+func (h *handler) SetMetrics(ctx context.Context, req *pb.SetMetricsRequest) (*pb.SetMetricsResponse, error) {
+	source := contextSource(ctx)
+	metrics := make(domain.MetricsList, 0, len(req.GetMetrics()))
+	for _, m := range req.GetMetrics() {
+		metric := fromProto(m)
+		metric.Source = source
+		metrics = append(metrics, metric)
+	}
+	result, err := h.metricService.SetMetrics(metrics)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	response := &pb.SetMetricsResponse{Metrics: make([]*pb.Metric, 0, len(result))}
+	for i := range result {
+		response.Metrics = append(response.Metrics, toProto(&result[i]))
+	}
+	return response, nil
+}
+
+func (h *handler) ListMetrics(_ *pb.ListMetricsRequest, stream pb.Metrics_ListMetricsServer) error {
+	metrics, err := h.metricService.GetAllMetrics()
+	if err != nil {
+		return toStatus(err)
+	}
+	for i := range metrics {
+		if err = stream.Send(toProto(&metrics[i])); err != nil {
+			return fmt.Errorf("failed to send metric: %w", err)
+		}
+	}
+	return nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrItemNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrIncorrectMetricType) ||
+		errors.Is(err, domain.ErrIncorrectMetricValue) ||
+		errors.Is(err, domain.ErrIncorrectLabels) ||
+		errors.Is(err, domain.ErrIncorrectBuckets) ||
+		errors.Is(err, domain.ErrIncorrectSketch) ||
+		errors.Is(err, domain.ErrIncorrectMeta) ||
+		errors.Is(err, domain.ErrUnregisteredMetric) ||
+		errors.Is(err, domain.ErrMetaMismatch) ||
+		errors.Is(err, domain.ErrValueOutOfRange) ||
+		errors.Is(err, domain.ErrEmptyBatch):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		logger.Log.Error("failed to handle grpc call", zap.Error(err))
+		return status.Error(codes.Internal, codes.Internal.String())
+	}
+}
+
+func toProto(m *domain.Metric) *pb.Metric {
+	metric := &pb.Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.Labels,
+	}
+	if h := m.Histogram; h != nil {
+		metric.Histogram = &pb.Histogram{Bounds: h.Bounds, Counts: h.Counts, Count: h.Count, Sum: h.Sum}
+	}
+	if s := m.Summary; s != nil {
+		metric.Summary = &pb.Sketch{
+			Alpha:    s.Alpha,
+			Positive: toProtoBins(s.Positive),
+			Negative: toProtoBins(s.Negative),
+			Zero:     s.Zero,
+			Count:    s.Count,
+			Sum:      s.Sum,
+			Min:      s.Min,
+			Max:      s.Max,
+		}
+	}
+	return metric
+}
+
+func toProtoBins(bins map[int]uint64) map[int64]uint64 {
+	if len(bins) == 0 {
+		return nil
+	}
+	result := make(map[int64]uint64, len(bins))
+	for index, count := range bins {
+		result[int64(index)] = count
+	}
+	return result
+}
+
+// contextSource описывает отправителя вызова: адрес соединения и метаданные x-agent-id.
+func contextSource(ctx context.Context) *domain.Source {
+	var address string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		address = p.Addr.String()
+	}
+	return domain.NewSource(address, metadataValue(ctx, "x-agent-id"))
+}
+
+func fromProto(m *pb.Metric) domain.Metric {
+	metric := domain.Metric{
+		ID:     m.GetId(),
+		MType:  m.GetType(),
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.GetLabels(),
+	}
+	if h := m.GetHistogram(); h != nil {
+		metric.Histogram = &domain.HistogramData{
+			Bounds: h.GetBounds(),
+			Counts: h.GetCounts(),
+			Count:  h.GetCount(),
+			Sum:    h.GetSum(),
+		}
+	}
+	if s := m.GetSummary(); s != nil {
+		metric.Summary = &domain.Sketch{
+			Alpha:    s.GetAlpha(),
+			Positive: fromProtoBins(s.GetPositive()),
+			Negative: fromProtoBins(s.GetNegative()),
+			Zero:     s.GetZero(),
+			Count:    s.GetCount(),
+			Sum:      s.GetSum(),
+			Min:      s.GetMin(),
+			Max:      s.GetMax(),
+		}
+	}
+	return metric
+}
+
+func fromProtoBins(bins map[int64]uint64) map[int]uint64 {
+	if len(bins) == 0 {
+		return nil
+	}
+	result := make(map[int]uint64, len(bins))
+	for index, count := range bins {
+		result[int(index)] = count
+	}
+	return result
+}
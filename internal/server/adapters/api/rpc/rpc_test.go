@@ -0,0 +1,130 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+	"metrics/internal/shared-kernel/hash"
+	"metrics/internal/shared-kernel/pb"
+)
+
+func TestSignInterceptor(t *testing.T) {
+	const key = "secret"
+	value := 1.5
+	req := &pb.SetMetricRequest{Metric: &pb.Metric{Id: "Alloc", Type: domain.Gauge, Value: &value}}
+	signature, err := hash.SignMessage(key, req)
+	assert.NoError(t, err)
+	forged, err := hash.SignMessage("other", req)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		key       string
+		method    string
+		signature string
+		code      codes.Code
+	}{
+		{name: "no key", method: pb.Metrics_SetMetric_FullMethodName, code: codes.OK},
+		{name: "signed write", key: key, method: pb.Metrics_SetMetric_FullMethodName, signature: signature, code: codes.OK},
+		{name: "unsigned write", key: key, method: pb.Metrics_SetMetric_FullMethodName, code: codes.Unauthenticated},
+		{name: "forged write", key: key, method: pb.Metrics_SetMetric_FullMethodName, signature: forged,
+			code: codes.Unauthenticated},
+		{name: "unsigned read", key: key, method: pb.Metrics_GetMetric_FullMethodName, code: codes.OK},
+		{name: "forged read", key: key, method: pb.Metrics_GetMetric_FullMethodName, signature: forged,
+			code: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.signature != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(hash.MetadataKey, tt.signature))
+			}
+			_, err := signInterceptor(tt.key)(ctx, req, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(ctx context.Context, req any) (any, error) {
+					return &pb.SetMetricResponse{}, nil
+				})
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{err: domain.ErrItemNotFound, code: codes.NotFound},
+		{err: domain.ErrIncorrectLabels, code: codes.InvalidArgument},
+		{err: domain.ErrIncorrectBuckets, code: codes.InvalidArgument},
+		{err: domain.ErrIncorrectSketch, code: codes.InvalidArgument},
+		{err: domain.ErrIncorrectMeta, code: codes.InvalidArgument},
+		{err: fmt.Errorf("%w: bad name", domain.ErrIncorrectLabels), code: codes.InvalidArgument},
+		{err: fmt.Errorf("disk is full"), code: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tt.code, status.Code(toStatus(tt.err)))
+		})
+	}
+}
+
+// Метки, гистограммы и summary передаются по gRPC так же, как через REST.
+func TestHandler_LabelsAndDistributions(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	h := &handler{metricService: metricService}
+	ctx := context.Background()
+	one, two := 1.0, 2.0
+	sketch := domain.NewSketch(domain.DefaultSketchAccuracy)
+	for _, v := range []float64{1, 2, 3} {
+		sketch.Add(v)
+	}
+	_, err = h.SetMetrics(ctx, &pb.SetMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "Load", Type: domain.Gauge, Value: &one, Labels: map[string]string{"host": "a"}},
+		{Id: "Load", Type: domain.Gauge, Value: &two, Labels: map[string]string{"host": "b"}},
+		{Id: "Latency", Type: domain.Histogram, Histogram: &pb.Histogram{
+			Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Count: 3, Sum: 7,
+		}},
+		toProto(&domain.Metric{ID: "Size", MType: domain.Summary, Summary: sketch}),
+	}})
+	assert.NoError(t, err)
+
+	hostB := map[string]string{"host": "b"}
+	resp, err := h.GetMetric(ctx, &pb.GetMetricRequest{Id: "Load", Type: domain.Gauge, Labels: hostB})
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, resp.GetMetric().GetValue())
+	assert.Equal(t, hostB, resp.GetMetric().GetLabels())
+	_, err = h.GetMetric(ctx, &pb.GetMetricRequest{Id: "Load", Type: domain.Gauge})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err = h.GetMetric(ctx, &pb.GetMetricRequest{Id: "Latency", Type: domain.Histogram})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 0, 2}, resp.GetMetric().GetHistogram().GetCounts())
+	assert.Equal(t, 7.0, resp.GetMetric().GetHistogram().GetSum())
+
+	resp, err = h.GetMetric(ctx, &pb.GetMetricRequest{Id: "Size", Type: domain.Summary})
+	assert.NoError(t, err)
+	assert.Equal(t, sketch, fromProto(resp.GetMetric()).Summary)
+}
@@ -0,0 +1,159 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const maxPacketSize = 65535
+
+var ErrMalformedLine = errors.New("malformed statsd line")
+
+type MetricService interface {
+	SetMetric(m *domain.Metric) (*domain.Metric, error)
+}
+
+type Listener struct {
+	metricService MetricService
+	conn          net.PacketConn
+	malformed     atomic.Uint64
+}
+
+func NewListener(metricService MetricService, address string) (*Listener, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen statsd address: %w", err)
+	}
+	return &Listener{
+		metricService: metricService,
+		conn:          conn,
+	}, nil
+}
+
+type line struct {
+	name     string
+	mType    string
+	value    float64
+	relative bool
+	rate     float64
+}
+
+// parseLine разбирает строку вида name:value|type[|@rate][|#tags].
+// Поддерживаются счётчики (c) и гауджи (g), включая относительные +/- обновления гауджей.
+func parseLine(raw string) (line, error) {
+	name, rest, found := strings.Cut(raw, ":")
+	if !found || name == "" {
+		return line{}, fmt.Errorf("%w: no metric name", ErrMalformedLine)
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return line{}, fmt.Errorf("%w: no metric type", ErrMalformedLine)
+	}
+	l := line{name: name, rate: 1}
+	switch parts[1] {
+	case "c":
+		l.mType = domain.Counter
+	case "g":
+		l.mType = domain.Gauge
+		l.relative = strings.HasPrefix(parts[0], "+") || strings.HasPrefix(parts[0], "-")
+	default:
+		return line{}, fmt.Errorf("%w: unsupported type %q", ErrMalformedLine, parts[1])
+	}
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return line{}, fmt.Errorf("%w: bad value %q", ErrMalformedLine, parts[0])
+	}
+	l.value = value
+	for _, part := range parts[2:] {
+		if !strings.HasPrefix(part, "@") {
+			continue
+		}
+		rate, err := strconv.ParseFloat(part[1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return line{}, fmt.Errorf("%w: bad sample rate %q", ErrMalformedLine, part)
+		}
+		l.rate = rate
+	}
+	return l, nil
+}
+
+func (l *Listener) Run() error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			logger.Log.Error("failed to read statsd packet", zap.Error(err))
+			continue
+		}
+		l.handlePacket(string(buf[:n]), domain.NewSource(addr.String(), ""))
+	}
+}
+
+func (l *Listener) Stop() {
+	if err := l.conn.Close(); err != nil {
+		logger.Log.Error("failed to close statsd listener", zap.Error(err))
+	}
+}
+
+func (l *Listener) Malformed() uint64 {
+	return l.malformed.Load()
+}
+
+func (l *Listener) handlePacket(packet string, source *domain.Source) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.malformed.Add(1)
+			logger.Log.Error("statsd packet handling panicked", zap.Any("panic", r))
+		}
+	}()
+	for _, raw := range strings.Split(packet, "\n") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		parsed, err := parseLine(raw)
+		if err != nil {
+			l.malformed.Add(1)
+			logger.Log.Info("skip statsd line",
+				zap.String("line", raw),
+				zap.Uint64("malformed", l.malformed.Load()),
+				zap.Error(err),
+			)
+			continue
+		}
+		if err = l.apply(&parsed, source); err != nil {
+			l.malformed.Add(1)
+			logger.Log.Info("failed to apply statsd line", zap.String("line", raw), zap.Error(err))
+		}
+	}
+}
+
+func (l *Listener) apply(parsed *line, source *domain.Source) error {
+	m := domain.Metric{ID: parsed.name, MType: parsed.mType, Source: source}
+	switch parsed.mType {
+	case domain.Counter:
+		delta := int64(math.Round(parsed.value / parsed.rate))
+		m.Delta = &delta
+	case domain.Gauge:
+		value := parsed.value
+		m.Relative = parsed.relative
+		m.Value = &value
+	}
+	if _, err := l.metricService.SetMetric(&m); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
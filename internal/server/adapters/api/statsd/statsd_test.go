@@ -0,0 +1,110 @@
+package statsd
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    line
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			raw:  "requests:3|c",
+			want: line{name: "requests", mType: domain.Counter, value: 3, rate: 1},
+		},
+		{
+			name: "sampledCounter",
+			raw:  "requests:1|c|@0.1",
+			want: line{name: "requests", mType: domain.Counter, value: 1, rate: 0.1},
+		},
+		{
+			name: "gauge",
+			raw:  "temperature:21.5|g|#room:kitchen",
+			want: line{name: "temperature", mType: domain.Gauge, value: 21.5, rate: 1},
+		},
+		{
+			name: "relativeGauge",
+			raw:  "queue:-4|g",
+			want: line{name: "queue", mType: domain.Gauge, value: -4, relative: true, rate: 1},
+		},
+		{name: "noName", raw: ":1|c", wantErr: true},
+		{name: "noType", raw: "requests:1", wantErr: true},
+		{name: "timer", raw: "latency:12|ms", wantErr: true},
+		{name: "badValue", raw: "requests:abc|c", wantErr: true},
+		{name: "badRate", raw: "requests:1|c|@0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLine(tt.raw)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrMalformedLine)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestListener_HandlePacket(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	metricService, err := service.NewMetricService(&config.Config{}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	l, err := NewListener(metricService, "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer l.Stop()
+	l.handlePacket("requests:1|c|@0.1\nqueue:10|g\nqueue:-4|g\nqueue:+1.5|g\ngarbage\n", domain.NewSource("10.0.0.1:8125", ""))
+
+	value, err := metricService.GetMetricValue(domain.Key{MType: domain.Counter, ID: "requests"})
+	assert.NoError(t, err)
+	assert.Equal(t, "10", value)
+	value, err = metricService.GetMetricValue(domain.Key{MType: domain.Gauge, ID: "queue"})
+	assert.NoError(t, err)
+	assert.Equal(t, "7.5", value)
+	assert.Equal(t, uint64(1), l.Malformed())
+
+	// Относительные изменения из параллельных пакетов не теряются.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.handlePacket("inflight:+1|g\n", domain.NewSource("10.0.0.2:8125", ""))
+		}()
+	}
+	wg.Wait()
+	value, err = metricService.GetMetricValue(domain.Key{MType: domain.Gauge, ID: "inflight"})
+	assert.NoError(t, err)
+	assert.Equal(t, "50", value)
+
+	metric, err := metricService.GetMetric(domain.Key{MType: domain.Gauge, ID: "queue"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, metric.Source) {
+		assert.Equal(t, "10.0.0.1", metric.Source.Address)
+	}
+}
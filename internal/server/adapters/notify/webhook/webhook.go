@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+	requestTimeout = 5 * time.Second
+)
+
+var errPermanent = errors.New("webhook rejected alerts")
+
+type payload struct {
+	Alerts []domain.Alert `json:"alerts"`
+}
+
+// Sender отправляет срабатывания POST-запросом с JSON {"alerts": [...]}.
+// Повторно присланные срабатывания в том же состоянии не отправляются.
+type Sender struct {
+	url     string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+
+	mux sync.Mutex
+	// sent - что уже доставлено по каждому fingerprint.
+	sent map[string]string
+}
+
+func NewSender(url string) *Sender {
+	return &Sender{
+		url:     url,
+		client:  &http.Client{Timeout: requestTimeout},
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		sent:    make(map[string]string),
+	}
+}
+
+// dedupKey различает состояния одного срабатывания: новое срабатывание по той же метрике
+// отличается временем начала.
+func dedupKey(a *domain.Alert) string {
+	return a.State + "@" + a.ActiveAt.UTC().Format(time.RFC3339Nano)
+}
+
+// Notify отправляет ещё не доставленные срабатывания. Fingerprint, которых нет в alerts, забываются,
+// поэтому память отправителя ограничена текущими срабатываниями.
+// Сетевые ошибки, 429 и 5xx повторяются с экспоненциальной задержкой, остальные ответы считаются окончательными:
+// такие срабатывания больше не отправляются, пока не сменят состояние.
+// s.mux не держится во время отправки, поэтому медленный получатель не блокирует других вызывающих.
+func (s *Sender) Notify(ctx context.Context, alerts []domain.Alert) error {
+	fresh := s.fresh(alerts)
+	if len(fresh) == 0 {
+		return nil
+	}
+	// Без экранирования HTML, чтобы сравнения в op оставались читаемыми для получателя.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(payload{Alerts: fresh}); err != nil {
+		return fmt.Errorf("failed to encode alerts: %w", err)
+	}
+	err := s.deliver(ctx, buf.Bytes(), len(fresh))
+	// Отклонённые получателем срабатывания тоже запоминаются: повторная отправка получила бы тот же ответ
+	// и повторялась бы на каждой проверке правил.
+	if err == nil || errors.Is(err, errPermanent) {
+		s.mux.Lock()
+		for i := range fresh {
+			s.sent[fresh[i].Fingerprint] = dedupKey(&fresh[i])
+		}
+		s.mux.Unlock()
+	}
+	return err
+}
+
+// fresh забывает fingerprint, которых нет в alerts, и возвращает копию ещё не доставленных срабатываний.
+func (s *Sender) fresh(alerts []domain.Alert) []domain.Alert {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	current := make(map[string]struct{}, len(alerts))
+	fresh := make([]domain.Alert, 0, len(alerts))
+	for i := range alerts {
+		current[alerts[i].Fingerprint] = struct{}{}
+		if s.sent[alerts[i].Fingerprint] != dedupKey(&alerts[i]) {
+			fresh = append(fresh, alerts[i])
+		}
+	}
+	for fingerprint := range s.sent {
+		if _, found := current[fingerprint]; !found {
+			delete(s.sent, fingerprint)
+		}
+	}
+	return fresh
+}
+
+// deliver отправляет body, повторяя временные ошибки с удваивающейся задержкой.
+func (s *Sender) deliver(ctx context.Context, body []byte, count int) error {
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err := s.send(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errPermanent) || attempt >= s.retries {
+			return fmt.Errorf("failed to deliver %d alerts after %d attempts: %w", count, attempt+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("alerts delivery cancelled: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *Sender) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send alerts: %w", err)
+	}
+	defer func() {
+		if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+			logger.Log.Info("failed to read webhook response", zap.Error(err))
+		}
+		if err := resp.Body.Close(); err != nil {
+			logger.Log.Error("failed to close webhook response", zap.Error(err))
+		}
+	}()
+	switch {
+	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	default:
+		return fmt.Errorf("%w: %s", errPermanent, resp.Status)
+	}
+}
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/server/core/domain"
+)
+
+func TestSender_Notify(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		received []payload
+		statuses = []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK, http.StatusBadRequest}
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		var p payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		received = append(received, p)
+		status := statuses[0]
+		statuses = statuses[1:]
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+	sender := NewSender(receiver.URL)
+	sender.backoff = time.Millisecond
+
+	now := time.Now()
+	firing := domain.Alert{Fingerprint: "heap/gauge/HeapInuse{}", Rule: "heap", State: domain.AlertFiring, ActiveAt: now}
+	resolved := firing
+	resolved.State = domain.AlertResolved
+
+	tests := []struct {
+		name     string
+		alerts   []domain.Alert
+		requests int
+		wantErr  bool
+	}{
+		{name: "retryAfterServerError", alerts: []domain.Alert{firing}, requests: 2},
+		{name: "dedupSameState", alerts: []domain.Alert{firing}, requests: 2},
+		{name: "stateChanged", alerts: []domain.Alert{resolved}, requests: 3},
+		{name: "clientErrorNotRetried", alerts: []domain.Alert{firing}, requests: 4, wantErr: true},
+		{name: "rejectedNotResent", alerts: []domain.Alert{firing}, requests: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sender.Notify(context.Background(), tt.alerts)
+			if tt.wantErr {
+				assert.Error(t, err, "client errors are not retried")
+			} else {
+				assert.NoError(t, err)
+			}
+			mux.Lock()
+			defer mux.Unlock()
+			assert.Len(t, received, tt.requests)
+		})
+	}
+	assert.Equal(t, domain.AlertFiring, received[1].Alerts[0].State)
+	assert.Equal(t, domain.AlertResolved, received[2].Alerts[0].State)
+}
+
+// Пока один вызов ждёт медленного получателя, другие вызовы не блокируются.
+func TestSender_NotifyDoesNotBlockOnSlowReceiver(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer receiver.Close()
+	sender := NewSender(receiver.URL)
+	alerts := []domain.Alert{{Fingerprint: "heap", State: domain.AlertFiring, ActiveAt: time.Now()}}
+	slowDone := make(chan error, 1)
+	go func() {
+		slowDone <- sender.Notify(context.Background(), alerts)
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sender.Notify(context.Background(), nil)
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("Notify is blocked by a delivery in progress")
+	}
+	close(release)
+	assert.NoError(t, <-slowDone)
+}
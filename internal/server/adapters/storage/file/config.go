@@ -1,6 +1,10 @@
 package file
 
+import "metrics/internal/server/core/domain"
+
 type Config struct {
 	Filepath      string
 	StoreInterval int
+	Retention     domain.Retention
+	Staleness     domain.Staleness
 }
@@ -1,110 +1,82 @@
 package file
 
 import (
+	"errors"
 	"fmt"
-	"metrics/internal/server/core/files"
-	"sync"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
 
+	"metrics/internal/server/adapters/storage/memory"
 	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/files"
+	"metrics/internal/server/logger"
 )
 
-type InMemoryStore struct {
-	mux     *sync.Mutex
-	metrics map[domain.Key]domain.Value
-}
-
+// MetricStorage хранит метрики в памяти и сохраняет их в файл снапшота.
+// В синхронном режиме (StoreInterval == 0) снапшот записывается до каждого изменения,
+// иначе его периодически сохраняет сервис.
 type MetricStorage struct {
-	InMemoryStore
-	filepath  string
-	syncWrite bool
+	*memory.MetricStorage
+	filepath string
 }
 
 func NewStorage(cfg *Config) (*MetricStorage, error) {
-	inMemoryStore := InMemoryStore{
-		mux:     &sync.Mutex{},
-		metrics: make(map[domain.Key]domain.Value),
+	s := &MetricStorage{
+		filepath: cfg.Filepath,
 	}
+	var persist memory.Persist
 	if cfg.StoreInterval == 0 {
-		return &MetricStorage{
-			inMemoryStore,
-			cfg.Filepath,
-			true,
-		}, nil
-	} else {
-		return &MetricStorage{
-			inMemoryStore,
-			cfg.Filepath,
-			false,
-		}, nil
+		persist = s.save
 	}
+	s.MetricStorage = memory.NewPersistentStorage(&memory.Config{
+		Retention: cfg.Retention,
+		Staleness: cfg.Staleness,
+	}, persist)
+	return s, nil
 }
 
-func (s *MetricStorage) SetMetric(m *domain.Metric) (*domain.Metric, error) {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-	var metric domain.Metric
-	key := domain.Key{MType: m.MType, ID: m.ID}
-	if m.MType == domain.Counter {
-		value, found := s.metrics[key]
-		if found {
-			*value.Delta += *m.Delta
-			s.metrics[key] = domain.Value{Delta: value.Delta}
-			metric = domain.Metric{
-				ID:    m.ID,
-				MType: m.MType,
-				Delta: value.Delta,
-			}
-		} else {
-			s.metrics[key] = domain.Value{Delta: m.Delta}
-			metric = domain.Metric{
-				ID:    m.ID,
-				MType: m.MType,
-				Delta: m.Delta,
-			}
-		}
-	} else {
-		s.metrics[key] = domain.Value{Value: m.Value}
-		metric = domain.Metric{
-			ID:    m.ID,
-			MType: m.MType,
-			Value: m.Value,
-		}
+func (s *MetricStorage) save(metrics domain.MetricValues, registry domain.Registry) error {
+	if err := files.SaveMetricsToFile(s.filepath, metrics, registry); err != nil {
+		return fmt.Errorf("failed to save metrics to file %w", err)
 	}
-	if s.syncWrite {
-		err := files.SaveMetricsToFile(s.filepath, s.metrics)
-		if err != nil {
-			return nil, fmt.Errorf("failed to save metrics to file %w", err)
-		}
-	}
-	return &metric, nil
+	return nil
 }
 
-func (s *MetricStorage) GetMetric(mType, mName string) (*domain.Metric, error) {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-	value, found := s.metrics[domain.Key{MType: mType, ID: mName}]
-	if !found {
-		return &domain.Metric{}, domain.ErrItemNotFound
+// Health проверяет, что снапшот можно перезаписать. Проверка ничего не меняет на диске:
+// существующий файл открывается на запись без O_CREATE и O_TRUNC, а если файла ещё нет,
+// в его каталоге создаётся и сразу удаляется временный файл.
+func (s *MetricStorage) Health() domain.HealthCheck {
+	check := domain.HealthCheck{
+		Name:   "file",
+		Status: domain.StatusOK,
 	}
-	return &domain.Metric{
-		ID:    mName,
-		MType: mType,
-		Value: value.Value,
-		Delta: value.Delta,
-	}, nil
+	if err := checkWritable(s.filepath); err != nil {
+		check.Status = domain.StatusError
+		check.Error = err.Error()
+	}
+	return check
 }
 
-func (s *MetricStorage) GetAllMetrics() (domain.MetricsList, error) {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-	metrics := make(domain.MetricsList, 0)
-	for k, v := range s.metrics {
-		metrics = append(metrics, domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
-		})
+func checkWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.CreateTemp(filepath.Dir(path), ".health-*")
+		if err != nil {
+			return fmt.Errorf("failed to create file in snapshot dir: %w", err)
+		}
+		defer func() {
+			if err := os.Remove(f.Name()); err != nil {
+				logger.Log.Error("failed to remove health check file", zap.Error(err))
+			}
+		}()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
 	}
-	return metrics, nil
+	return nil
 }
@@ -0,0 +1,70 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/server/core/domain"
+)
+
+// Если снапшот не удалось сохранить, хранилище в памяти не меняется и не расходится с файлом.
+func TestMetricStorage_FailedSaveKeepsState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	assert.NoError(t, os.Mkdir(dir, 0o755))
+	s, err := NewStorage(&Config{
+		Filepath:  filepath.Join(dir, "metrics.json"),
+		Staleness: domain.Staleness{Evict: time.Minute},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	value := 1.0
+	_, err = s.SetMetrics(domain.MetricsList{
+		{ID: "Alloc", MType: domain.Gauge, Value: &value},
+		{ID: "HeapSys", MType: domain.Gauge, Value: &value},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, os.RemoveAll(dir))
+	alloc := domain.Key{MType: domain.Gauge, ID: "Alloc"}
+
+	assert.Error(t, s.DeleteMetric(alloc))
+	deleted, err := s.DeleteMetrics(&domain.MetricQuery{MType: domain.Gauge})
+	assert.Error(t, err)
+	assert.Zero(t, deleted)
+	evicted, err := s.EvictStale(time.Now().Add(time.Hour))
+	assert.Error(t, err)
+	assert.Zero(t, evicted)
+	assert.Error(t, s.SetMeta(&domain.Meta{Name: "Alloc", MType: domain.Gauge}))
+
+	metrics, err := s.GetAllMetrics()
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	_, err = s.GetMeta("Alloc")
+	assert.ErrorIs(t, err, domain.ErrItemNotFound)
+}
+
+// Проверка готовности не создаёт файл снапшота и не оставляет временных файлов.
+func TestMetricStorage_HealthDoesNotCreateSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorage(&Config{Filepath: filepath.Join(dir, "metrics.json")})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, domain.StatusOK, s.Health().Status)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	s, err = NewStorage(&Config{Filepath: filepath.Join(dir, "missing", "metrics.json")})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, domain.StatusError, s.Health().Status)
+}
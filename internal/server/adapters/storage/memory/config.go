@@ -1,3 +1,8 @@
 package memory
 
-type Config struct{}
+import "metrics/internal/server/core/domain"
+
+type Config struct {
+	Retention domain.Retention
+	Staleness domain.Staleness
+}
@@ -1,81 +1,333 @@
 package memory
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"metrics/internal/server/core/domain"
 )
 
+// Persist сохраняет будущее состояние хранилища. Хранилище вызывает его под своим мьютексом до изменения
+// и при ошибке оставляет данные прежними, поэтому память и внешняя копия не расходятся.
+type Persist func(metrics domain.MetricValues, registry domain.Registry) error
+
 type MetricStorage struct {
-	mux     *sync.Mutex
-	metrics map[domain.Key]domain.Value
+	mux       *sync.Mutex
+	metrics   map[domain.Key]domain.Value
+	meta      domain.Registry
+	retention domain.Retention
+	staleness domain.Staleness
+	persist   Persist
 }
 
 func NewStorage(cfg *Config) (*MetricStorage, error) {
+	return NewPersistentStorage(cfg, nil), nil
+}
+
+// NewPersistentStorage создаёт хранилище, которое перед каждым изменением метрик или реестра вызывает persist.
+// С nil persist хранилище ничем не отличается от созданного NewStorage.
+func NewPersistentStorage(cfg *Config, persist Persist) *MetricStorage {
 	return &MetricStorage{
-		mux:     &sync.Mutex{},
-		metrics: make(map[domain.Key]domain.Value),
-	}, nil
+		mux:       &sync.Mutex{},
+		metrics:   make(map[domain.Key]domain.Value),
+		meta:      make(domain.Registry),
+		retention: cfg.Retention,
+		staleness: cfg.Staleness,
+		persist:   persist,
+	}
 }
 
-func (s *MetricStorage) GetMetric(mType, mName string) (*domain.Metric, error) {
+func (s *MetricStorage) GetMetric(key domain.Key) (*domain.Metric, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	value, found := s.metrics[domain.Key{MType: mType, ID: mName}]
+	value, found := s.metrics[key]
 	if !found {
 		return &domain.Metric{}, domain.ErrItemNotFound
 	}
-	return &domain.Metric{
-		ID:    mName,
-		MType: mType,
-		Value: value.Value,
-		Delta: value.Delta,
+	metric := s.metric(key, value, time.Now())
+	return &metric, nil
+}
+
+func (s *MetricStorage) GetMetricDetails(key domain.Key) (*domain.MetricDetails, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	value, found := s.metrics[key]
+	if !found {
+		return nil, domain.ErrItemNotFound
+	}
+	return &domain.MetricDetails{
+		Metric:  s.metric(key, value, time.Now()),
+		Updated: value.Updated,
 	}, nil
 }
 
 func (s *MetricStorage) SetMetric(m *domain.Metric) (*domain.Metric, error) {
+	metrics, err := s.SetMetrics(domain.MetricsList{*m})
+	if err != nil {
+		return nil, err
+	}
+	return &metrics[0], nil
+}
+
+func (s *MetricStorage) SetMetrics(metrics domain.MetricsList) (domain.MetricsList, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	key := domain.Key{MType: m.MType, ID: m.ID}
-	if m.MType == domain.Counter {
-		value, found := s.metrics[key]
-		if found {
-			*value.Delta += *m.Delta
-			s.metrics[key] = domain.Value{Delta: value.Delta}
-			return &domain.Metric{
-				ID:    m.ID,
-				MType: m.MType,
-				Delta: value.Delta,
-			}, nil
-		} else {
-			s.metrics[key] = domain.Value{Delta: m.Delta}
-			return &domain.Metric{
-				ID:    m.ID,
-				MType: m.MType,
-				Delta: m.Delta,
-			}, nil
+	keys, updated, err := domain.StageMetrics(s.metrics, metrics)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	if err = s.commit(updated); err != nil {
+		return nil, err
+	}
+	return domain.CollectMetrics(keys, updated), nil
+}
+
+// commit записывает подготовленные значения и дописывает их в историю. Вызывается под s.mux.
+// Если задан persist, сначала сохраняется будущее состояние, а история копируется,
+// потому что Record дописывает в буфер на месте.
+func (s *MetricStorage) commit(updated map[domain.Key]domain.Value) error {
+	now := time.Now()
+	next := make(map[domain.Key]domain.Value, len(updated))
+	for k, v := range updated {
+		history := v.History
+		if s.persist != nil {
+			history = history.Clone()
+		}
+		v.History = s.retention.Record(history, v, now)
+		v.Updated = now
+		next[k] = v
+	}
+	if s.persist != nil {
+		snapshot := s.values()
+		for k, v := range next {
+			snapshot[k] = v
+		}
+		if err := s.persist(snapshot, s.meta); err != nil {
+			return fmt.Errorf("failed to persist metrics: %w", err)
+		}
+	}
+	for k, v := range next {
+		s.metrics[k] = v
+	}
+	return nil
+}
+
+// remove удаляет метрики по ключам. Вызывается под s.mux.
+// Как и commit, при заданном persist сначала сохраняет состояние без удаляемых метрик.
+func (s *MetricStorage) remove(keys []domain.Key) error {
+	if s.persist != nil {
+		snapshot := s.values()
+		for _, k := range keys {
+			delete(snapshot, k)
+		}
+		if err := s.persist(snapshot, s.meta); err != nil {
+			return fmt.Errorf("failed to persist metrics: %w", err)
+		}
+	}
+	for _, k := range keys {
+		delete(s.metrics, k)
+	}
+	return nil
+}
+
+// values копирует map значений без глубокого копирования истории. Вызывается под s.mux.
+func (s *MetricStorage) values() domain.MetricValues {
+	values := make(domain.MetricValues, len(s.metrics))
+	for k, v := range s.metrics {
+		values[k] = v
+	}
+	return values
+}
+
+func (s *MetricStorage) QueryMetrics(q *domain.MetricQuery) (domain.MetricPage, error) {
+	s.mux.Lock()
+	now := time.Now()
+	metrics := make(domain.MetricsList, 0)
+	for k, v := range s.metrics {
+		if !q.Match(k.MType, k.ID, v.Labels) {
+			continue
 		}
-	} else {
-		s.metrics[key] = domain.Value{Value: m.Value}
-		return &domain.Metric{
-			ID:    m.ID,
-			MType: m.MType,
-			Value: m.Value,
-		}, nil
+		metrics = append(metrics, s.metric(k, v, now))
 	}
+	s.mux.Unlock()
+	return q.Paginate(metrics), nil
 }
 
 func (s *MetricStorage) GetAllMetrics() (domain.MetricsList, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	now := time.Now()
 	metrics := make(domain.MetricsList, 0)
 	for k, v := range s.metrics {
-		metrics = append(metrics, domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
-		})
+		metrics = append(metrics, s.metric(k, v, now))
 	}
 	return metrics, nil
 }
+
+// metric собирает метрику из значения хранилища и отмечает устаревшие gauge.
+func (s *MetricStorage) metric(k domain.Key, v domain.Value, now time.Time) domain.Metric {
+	m := domain.NewMetric(k, v)
+	m.Stale = s.staleness.Stale(k, v, now)
+	return m
+}
+
+func (s *MetricStorage) GetHistory(key domain.Key, from, to time.Time) ([]domain.Sample, error) {
+	if !s.retention.Enabled() {
+		return nil, domain.ErrHistoryDisabled
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	value, found := s.metrics[key]
+	if !found {
+		return nil, domain.ErrItemNotFound
+	}
+	if value.History == nil {
+		return []domain.Sample{}, nil
+	}
+	if s.retention.MaxAge > 0 {
+		if oldest := time.Now().Add(-s.retention.MaxAge); from.Before(oldest) {
+			from = oldest
+		}
+	}
+	return value.History.Range(from, to), nil
+}
+
+func (s *MetricStorage) Snapshot() (domain.MetricValues, domain.Registry, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	snapshot := make(domain.MetricValues, len(s.metrics))
+	for k, v := range s.metrics {
+		snapshot[k] = v.Clone()
+	}
+	return snapshot, s.registry(), nil
+}
+
+func (s *MetricStorage) Restore(metrics domain.MetricValues, registry domain.Registry) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	now := time.Now()
+	for k, v := range metrics {
+		if v.History != nil {
+			v.History = s.retention.Rebuild(v.History.Range(time.Time{}, time.Time{}), now)
+		}
+		s.metrics[k] = v
+	}
+	for name, meta := range registry {
+		s.meta[name] = meta
+	}
+	return nil
+}
+
+func (s *MetricStorage) SetMeta(meta *domain.Meta) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	registry := s.registry()
+	registry[meta.Name] = *meta
+	if s.persist != nil {
+		if err := s.persist(s.metrics, registry); err != nil {
+			return fmt.Errorf("failed to persist metadata: %w", err)
+		}
+	}
+	s.meta = registry
+	return nil
+}
+
+func (s *MetricStorage) GetMeta(name string) (*domain.Meta, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	meta, found := s.meta[name]
+	if !found {
+		return nil, domain.ErrItemNotFound
+	}
+	return &meta, nil
+}
+
+func (s *MetricStorage) GetAllMeta() (domain.Registry, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.registry(), nil
+}
+
+// registry копирует реестр описаний. Вызывается под s.mux.
+func (s *MetricStorage) registry() domain.Registry {
+	registry := make(domain.Registry, len(s.meta))
+	for name, meta := range s.meta {
+		registry[name] = meta
+	}
+	return registry
+}
+
+func (s *MetricStorage) Health() domain.HealthCheck {
+	return domain.HealthCheck{
+		Name:   "memory",
+		Status: domain.StatusOK,
+	}
+}
+
+func (s *MetricStorage) DeleteMetric(key domain.Key) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, found := s.metrics[key]; !found {
+		return domain.ErrItemNotFound
+	}
+	return s.remove([]domain.Key{key})
+}
+
+func (s *MetricStorage) DeleteMetrics(q *domain.MetricQuery) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var keys []domain.Key
+	for k, v := range s.metrics {
+		if q.Match(k.MType, k.ID, v.Labels) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if err := s.remove(keys); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// EvictStale удаляет gauge, которые не обновлялись дольше срока удаления.
+func (s *MetricStorage) EvictStale(now time.Time) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var keys []domain.Key
+	for k, v := range s.metrics {
+		if s.staleness.Expired(k, v, now) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if err := s.remove(keys); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+func (s *MetricStorage) ResetCounter(key domain.Key) (*domain.Metric, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	current, found := s.metrics[key]
+	if !found {
+		return &domain.Metric{}, domain.ErrItemNotFound
+	}
+	var delta int64
+	reset := domain.Value{Delta: &delta, Labels: current.Labels, History: current.History, Source: current.Source}
+	if err := s.commit(map[domain.Key]domain.Value{key: reset}); err != nil {
+		return nil, err
+	}
+	return &domain.Metric{
+		ID:     key.ID,
+		MType:  key.MType,
+		Delta:  &delta,
+		Labels: current.Labels,
+		Source: current.Source,
+	}, nil
+}
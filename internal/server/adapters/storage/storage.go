@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"metrics/internal/server/adapters/storage/file"
 	"metrics/internal/server/adapters/storage/memory"
@@ -10,9 +11,23 @@ import (
 )
 
 type MetricStorage interface {
-	GetMetric(mType, mName string) (*domain.Metric, error)
+	GetMetric(key domain.Key) (*domain.Metric, error)
+	GetMetricDetails(key domain.Key) (*domain.MetricDetails, error)
 	SetMetric(m *domain.Metric) (*domain.Metric, error)
+	SetMetrics(metrics domain.MetricsList) (domain.MetricsList, error)
 	GetAllMetrics() (domain.MetricsList, error)
+	QueryMetrics(q *domain.MetricQuery) (domain.MetricPage, error)
+	DeleteMetric(key domain.Key) error
+	DeleteMetrics(q *domain.MetricQuery) (int, error)
+	EvictStale(now time.Time) (int, error)
+	ResetCounter(key domain.Key) (*domain.Metric, error)
+	GetHistory(key domain.Key, from, to time.Time) ([]domain.Sample, error)
+	SetMeta(meta *domain.Meta) error
+	GetMeta(name string) (*domain.Meta, error)
+	GetAllMeta() (domain.Registry, error)
+	Snapshot() (domain.MetricValues, domain.Registry, error)
+	Restore(metrics domain.MetricValues, registry domain.Registry) error
+	Health() domain.HealthCheck
 }
 
 func NewStorage(cfg Config) (MetricStorage, error) {
@@ -3,29 +3,51 @@ package config
 import (
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v11"
+
+	"metrics/internal/server/core/domain"
 )
 
 const (
-	storeInterval = 300
+	storeInterval    = 300
+	historySize      = 360
+	historyRetention = 3600
+	alertInterval    = 15
 )
 
 type Config struct {
-	Address         string `env:"ADDRESS"`
-	StoreInterval   int    `env:"STORE_INTERVAL"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
-	Restore         bool   `env:"RESTORE"`
-	LogLevel        string
+	Address          string `env:"ADDRESS"`
+	GRPCAddress      string `env:"GRPC_ADDRESS"`
+	StatsdAddress    string `env:"STATSD_ADDRESS"`
+	GraphiteAddress  string `env:"GRAPHITE_ADDRESS"`
+	GraphiteCounters string `env:"GRAPHITE_COUNTERS"`
+	StoreInterval    int    `env:"STORE_INTERVAL"`
+	FileStoragePath  string `env:"FILE_STORAGE_PATH"`
+	Restore          bool   `env:"RESTORE"`
+	HistorySize      int    `env:"HISTORY_SIZE"`
+	HistoryRetention int    `env:"HISTORY_RETENTION"`
+	StaleTTL         int    `env:"STALE_TTL"`
+	StaleTTLs        string `env:"STALE_TTLS"`
+	EvictTTL         int    `env:"EVICT_TTL"`
+	AlertRules       string `env:"ALERT_RULES"`
+	AlertWebhook     string `env:"ALERT_WEBHOOK"`
+	AlertInterval    int    `env:"ALERT_INTERVAL"`
+	RateLimitUpdate  string `env:"RATE_LIMIT_UPDATE"`
+	RateLimitValue   string `env:"RATE_LIMIT_VALUE"`
+	RateLimitRoot    string `env:"RATE_LIMIT_ROOT"`
+	Key              string `env:"KEY"`
+	CryptoKey        string `env:"CRYPTO_KEY"`
+	TrustedSubnet    string `env:"TRUSTED_SUBNET"`
+	TrustedReads     bool   `env:"TRUSTED_SUBNET_READS"`
+	StrictMeta       bool   `env:"STRICT_METADATA"`
+	LogLevel         string
 }
 
 func NewConfig() (*Config, error) {
 	var cfg Config
-	flag.StringVar(&cfg.Address, "a", ":8080", "port to run server")
-	flag.IntVar(&cfg.StoreInterval, "i", storeInterval, "time interval (seconds) to backup server data")
-	flag.StringVar(&cfg.FileStoragePath, "f", "/tmp/metrics-db.json", "where to store server data")
-	flag.BoolVar(&cfg.Restore, "r", true, "recover data from files")
-	flag.StringVar(&cfg.LogLevel, "l", "info", "log level")
+	registerFlags(flag.CommandLine, &cfg)
 	flag.Parse()
 
 	err := env.Parse(&cfg)
@@ -34,3 +56,47 @@ func NewConfig() (*Config, error) {
 	}
 	return &cfg, nil
 }
+
+// Default возвращает конфигурацию со значениями флагов по умолчанию, без аргументов и переменных окружения.
+func Default() *Config {
+	var cfg Config
+	registerFlags(flag.NewFlagSet("server", flag.ContinueOnError), &cfg)
+	return &cfg
+}
+
+// Retention - настройки истории метрик. По умолчанию хранится до historySize значений за последний час,
+// этого хватает для запросов вроде rate за 5m при отчётах агента раз в 10 секунд.
+func (c *Config) Retention() domain.Retention {
+	return domain.Retention{
+		Size:   c.HistorySize,
+		MaxAge: time.Duration(c.HistoryRetention) * time.Second,
+	}
+}
+
+func registerFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Address, "a", ":8080", "port to run server")
+	fs.StringVar(&cfg.GRPCAddress, "g", "", "port to run gRPC server, empty - disabled")
+	fs.StringVar(&cfg.StatsdAddress, "statsd-addr", "", "udp address to receive statsd metrics, empty - disabled")
+	fs.StringVar(&cfg.GraphiteAddress, "graphite-addr", "", "tcp address to receive graphite metrics, empty - disabled")
+	fs.StringVar(&cfg.GraphiteCounters, "graphite-counters", "", "comma separated path patterns stored as counters")
+	fs.IntVar(&cfg.StoreInterval, "i", storeInterval, "time interval (seconds) to backup server data")
+	fs.StringVar(&cfg.FileStoragePath, "f", "/tmp/metrics-db.json", "where to store server data")
+	fs.BoolVar(&cfg.Restore, "r", true, "recover data from files")
+	fs.IntVar(&cfg.HistorySize, "history-size", historySize, "samples kept per metric for history and query APIs, 0 - off")
+	fs.IntVar(&cfg.HistoryRetention, "history-retention", historyRetention, "max age (seconds) of history samples")
+	fs.IntVar(&cfg.StaleTTL, "stale-ttl", 0, "seconds without updates after which gauges are marked stale, 0 - disabled")
+	fs.StringVar(&cfg.StaleTTLs, "stale-ttls", "", "comma separated pattern=seconds stale ttls by gauge name")
+	fs.IntVar(&cfg.EvictTTL, "evict-ttl", 0, "seconds without updates after which gauges are removed, 0 - disabled")
+	fs.StringVar(&cfg.AlertRules, "alert-rules", "", "path to JSON file with alert rules, empty - alerting disabled")
+	fs.StringVar(&cfg.AlertWebhook, "alert-webhook", "", "url to POST alert notifications to")
+	fs.IntVar(&cfg.AlertInterval, "alert-interval", alertInterval, "how often (seconds) to evaluate alert rules")
+	fs.StringVar(&cfg.RateLimitUpdate, "rate-limit-update", "", "rate[:burst] per client for writes")
+	fs.StringVar(&cfg.RateLimitValue, "rate-limit-value", "", "rate[:burst] per client for /value")
+	fs.StringVar(&cfg.RateLimitRoot, "rate-limit-root", "", "rate[:burst] per client for other routes")
+	fs.StringVar(&cfg.Key, "k", "", "key to sign requests with HMAC-SHA256")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", "", "path to private key PEM to decrypt agent requests")
+	fs.StringVar(&cfg.TrustedSubnet, "t", "", "CIDR of agents allowed to write metrics")
+	fs.BoolVar(&cfg.TrustedReads, "trusted-reads", false, "apply trusted subnet to read-only routes too")
+	fs.BoolVar(&cfg.StrictMeta, "strict-metadata", false, "accept only metrics registered in metadata registry")
+	fs.StringVar(&cfg.LogLevel, "l", "info", "log level")
+}
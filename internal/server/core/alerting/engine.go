@@ -0,0 +1,179 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// resolvedRetention - сколько разрешённое срабатывание ещё передаётся уведомителю,
+// чтобы он успел доставить его, если первые попытки не удались.
+const resolvedRetention = 5 * time.Minute
+
+type MetricService interface {
+	QueryMetrics(q *domain.MetricQuery) (domain.MetricPage, error)
+}
+
+// Notifier доставляет срабатывания. Engine передаёт ему все firing и недавно разрешённые срабатывания
+// на каждой проверке, поэтому уведомитель сам отсеивает уже доставленные.
+type Notifier interface {
+	Notify(ctx context.Context, alerts []domain.Alert) error
+}
+
+// Engine периодически проверяет правила по текущим значениям метрик.
+// Срабатывание проходит состояния pending, firing и resolved: pending - условие выполняется меньше For,
+// firing - дольше, resolved - условие перестало выполняться после firing или метрика пропала.
+type Engine struct {
+	rules    []domain.AlertRule
+	metrics  MetricService
+	notifier Notifier
+	interval time.Duration
+
+	mux    sync.Mutex
+	alerts map[string]*domain.Alert
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewEngine создаёт движок. notifier может быть nil, тогда срабатывания видны только через Alerts.
+func NewEngine(rules []domain.AlertRule, metrics MetricService, notifier Notifier, interval time.Duration) *Engine {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Engine{
+		rules:    rules,
+		metrics:  metrics,
+		notifier: notifier,
+		interval: interval,
+		alerts:   make(map[string]*domain.Alert),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start запускает периодическую проверку. Без правил ничего не делает.
+func (e *Engine) Start() {
+	if len(e.rules) == 0 {
+		return
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		t := time.NewTicker(e.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-e.ctx.Done():
+				return
+			case now := <-t.C:
+				e.notify(e.Evaluate(now))
+			}
+		}
+	}()
+}
+
+// Stop прерывает текущую доставку уведомлений и ждёт остановки проверок.
+func (e *Engine) Stop() {
+	e.stopOnce.Do(e.cancel)
+	e.wg.Wait()
+}
+
+// Evaluate проверяет правила на момент now и возвращает срабатывания для уведомления: firing и resolved.
+func (e *Engine) Evaluate(now time.Time) []domain.Alert {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	seen := make(map[string]struct{})
+	for i := range e.rules {
+		rule := &e.rules[i]
+		page, err := e.metrics.QueryMetrics(&rule.Selector)
+		if err != nil {
+			logger.Log.Error("failed to evaluate alert rule", zap.String("rule", rule.Name), zap.Error(err))
+			// Без данных состояние срабатываний правила не меняется.
+			for fingerprint, alert := range e.alerts {
+				if alert.Rule == rule.Name {
+					seen[fingerprint] = struct{}{}
+				}
+			}
+			continue
+		}
+		for j := range page.Metrics {
+			m := &page.Metrics[j]
+			// Устаревшие gauge не отражают текущее состояние, по ним срабатывание разрешается.
+			if m.Stale || !rule.Holds(m.Number()) {
+				continue
+			}
+			fingerprint := domain.AlertFingerprint(rule.Name, m)
+			seen[fingerprint] = struct{}{}
+			alert, found := e.alerts[fingerprint]
+			if !found || alert.State == domain.AlertResolved {
+				alert = domain.NewAlert(rule, m, now)
+				e.alerts[fingerprint] = alert
+			}
+			alert.Value = m.Number()
+			if alert.State == domain.AlertPending && now.Sub(alert.ActiveAt) >= rule.For {
+				fired := now
+				alert.State = domain.AlertFiring
+				alert.FiredAt = &fired
+			}
+		}
+	}
+	for fingerprint, alert := range e.alerts {
+		if _, found := seen[fingerprint]; found {
+			continue
+		}
+		switch alert.State {
+		case domain.AlertPending:
+			delete(e.alerts, fingerprint)
+		case domain.AlertFiring:
+			resolved := now
+			alert.State = domain.AlertResolved
+			alert.ResolvedAt = &resolved
+		case domain.AlertResolved:
+			if now.Sub(*alert.ResolvedAt) > resolvedRetention {
+				delete(e.alerts, fingerprint)
+			}
+		}
+	}
+	return e.collect(func(a *domain.Alert) bool {
+		return a.State != domain.AlertPending
+	})
+}
+
+// Alerts возвращает активные срабатывания: pending и firing.
+func (e *Engine) Alerts() []domain.Alert {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return e.collect(func(a *domain.Alert) bool {
+		return a.State != domain.AlertResolved
+	})
+}
+
+// collect копирует подходящие срабатывания, упорядоченные по fingerprint. Вызывается под e.mux.
+func (e *Engine) collect(match func(a *domain.Alert) bool) []domain.Alert {
+	alerts := make([]domain.Alert, 0)
+	for _, alert := range e.alerts {
+		if match(alert) {
+			alerts = append(alerts, *alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Fingerprint < alerts[j].Fingerprint
+	})
+	return alerts
+}
+
+func (e *Engine) notify(alerts []domain.Alert) {
+	if e.notifier == nil || len(alerts) == 0 {
+		return
+	}
+	if err := e.notifier.Notify(e.ctx, alerts); err != nil {
+		logger.Log.Error("failed to send alerts", zap.Int("alerts", len(alerts)), zap.Error(err))
+	}
+}
@@ -0,0 +1,86 @@
+package alerting
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/server/core/domain"
+)
+
+type stubMetrics struct {
+	metrics domain.MetricsList
+}
+
+func (s *stubMetrics) QueryMetrics(q *domain.MetricQuery) (domain.MetricPage, error) {
+	page := domain.MetricPage{}
+	for _, m := range s.metrics {
+		if q.Match(m.MType, m.ID, m.Labels) {
+			page.Metrics = append(page.Metrics, m)
+		}
+	}
+	return page, nil
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`{"rules": [
+		{"name": "heap", "type": "gauge", "metric": "Heap*", "op": ">", "threshold": 100, "for": "2m"}
+	]}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	gauge := func(id string, value float64) domain.Metric {
+		return domain.Metric{ID: id, MType: domain.Gauge, Value: &value}
+	}
+	metrics := &stubMetrics{}
+	engine := NewEngine(rules, metrics, nil, time.Minute)
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		metrics domain.MetricsList
+		after   time.Duration
+		active  []string
+		notify  []string
+	}{
+		{name: "belowThreshold", metrics: domain.MetricsList{gauge("HeapInuse", 50)}},
+		{name: "pending", metrics: domain.MetricsList{gauge("HeapInuse", 150), gauge("HeapAlloc", 150)},
+			after: time.Minute, active: []string{domain.AlertPending, domain.AlertPending}},
+		{name: "pendingCleared", metrics: domain.MetricsList{gauge("HeapInuse", 150)},
+			after: 2 * time.Minute, active: []string{domain.AlertPending}},
+		{name: "firing", metrics: domain.MetricsList{gauge("HeapInuse", 150)},
+			after: 3 * time.Minute, active: []string{domain.AlertFiring}, notify: []string{domain.AlertFiring}},
+		{name: "resolved", metrics: domain.MetricsList{gauge("HeapInuse", 50)},
+			after: 4 * time.Minute, notify: []string{domain.AlertResolved}},
+		{name: "resolvedForgotten", metrics: domain.MetricsList{gauge("HeapInuse", 50)},
+			after: 4*time.Minute + resolvedRetention + time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics.metrics = tt.metrics
+			notify := engine.Evaluate(start.Add(tt.after))
+			states := make([]string, 0)
+			for _, alert := range notify {
+				states = append(states, alert.State)
+			}
+			assert.ElementsMatch(t, tt.notify, states)
+			states = states[:0]
+			for _, alert := range engine.Alerts() {
+				states = append(states, alert.State)
+			}
+			assert.ElementsMatch(t, tt.active, states)
+		})
+	}
+
+	for _, bad := range []string{
+		`{"rules": [{"name": "a", "metric": "x", "op": "~", "threshold": 1}]}`,
+		`{"rules": [{"name": "a", "metric": "x", "op": ">"}]}`,
+		`{"rules": [{"name": "a", "metric": "x", "op": ">", "threshold": 1, "for": "soon"}]}`,
+		`{"rules": [{"name": "a", "metric": "x", "op": ">", "threshold": 1}, {"name": "a", "metric": "y", "op": "<", "threshold": 1}]}`,
+	} {
+		_, err = ParseRules(strings.NewReader(bad))
+		assert.ErrorIs(t, err, domain.ErrIncorrectRule, bad)
+	}
+}
@@ -0,0 +1,106 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// ruleFile - формат файла правил:
+//
+//	{"rules": [{"name": "HighHeap", "type": "gauge", "metric": "HeapInuse", "op": ">", "threshold": 1e9, "for": "2m"}]}
+//
+// metric - имя метрики или шаблон path.Match, labels - селектор меток, for - длительность в формате time.ParseDuration.
+type ruleFile struct {
+	Rules []ruleSpec `json:"rules"`
+}
+
+type ruleSpec struct {
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Metric    string        `json:"metric"`
+	Labels    domain.Labels `json:"labels"`
+	Op        string        `json:"op"`
+	Threshold *float64      `json:"threshold"`
+	For       string        `json:"for"`
+}
+
+func LoadRules(filepath string) ([]domain.AlertRule, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open alert rules: %w", err)
+	}
+	defer func() {
+		if err = f.Close(); err != nil {
+			logger.Log.Error("failed to close alert rules", zap.Error(err))
+		}
+	}()
+	return ParseRules(f)
+}
+
+func ParseRules(r io.Reader) ([]domain.AlertRule, error) {
+	var file ruleFile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrIncorrectRule, err)
+	}
+	rules := make([]domain.AlertRule, 0, len(file.Rules))
+	names := make(map[string]struct{}, len(file.Rules))
+	for _, spec := range file.Rules {
+		rule, err := spec.rule()
+		if err != nil {
+			return nil, err
+		}
+		if _, found := names[rule.Name]; found {
+			return nil, fmt.Errorf("%w: duplicate name %q", domain.ErrIncorrectRule, rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (s *ruleSpec) rule() (domain.AlertRule, error) {
+	rule := domain.AlertRule{
+		Name: s.Name,
+		Selector: domain.MetricQuery{
+			MType:  s.Type,
+			Glob:   s.Metric,
+			Labels: s.Labels,
+		},
+		Op: s.Op,
+	}
+	if s.Metric == "" {
+		return rule, fmt.Errorf("%w: %q: metric is required", domain.ErrIncorrectRule, s.Name)
+	}
+	if _, err := path.Match(s.Metric, ""); err != nil {
+		return rule, fmt.Errorf("%w: %q: bad metric pattern", domain.ErrIncorrectRule, s.Name)
+	}
+	if s.Threshold == nil {
+		return rule, fmt.Errorf("%w: %q: threshold is required", domain.ErrIncorrectRule, s.Name)
+	}
+	rule.Threshold = *s.Threshold
+	if s.For != "" {
+		hold, err := time.ParseDuration(s.For)
+		if err != nil {
+			return rule, fmt.Errorf("%w: %q: bad for %q", domain.ErrIncorrectRule, s.Name, s.For)
+		}
+		rule.For = hold
+	}
+	if err := s.Labels.Validate(); err != nil {
+		return rule, fmt.Errorf("%w: %q: %w", domain.ErrIncorrectRule, s.Name, err)
+	}
+	if err := rule.Validate(); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
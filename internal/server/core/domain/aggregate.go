@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	ErrUnknownAggregation = errors.New("unknown aggregation")
+	ErrNotCounter         = errors.New("aggregation is defined only for counters")
+	ErrNotGauge           = errors.New("aggregation is defined only for gauges")
+	ErrNoSamples          = errors.New("no samples in window")
+	ErrIncorrectWindow    = errors.New("window must be positive")
+)
+
+type Aggregation string
+
+const (
+	AggMin      Aggregation = "min"
+	AggMax      Aggregation = "max"
+	AggAvg      Aggregation = "avg"
+	AggSum      Aggregation = "sum"
+	AggLast     Aggregation = "last"
+	AggCount    Aggregation = "count"
+	AggRate     Aggregation = "rate"
+	AggIncrease Aggregation = "increase"
+)
+
+func ParseAggregation(s string) (Aggregation, error) {
+	switch a := Aggregation(s); a {
+	case AggMin, AggMax, AggAvg, AggSum, AggLast, AggCount, AggRate, AggIncrease:
+		return a, nil
+	default:
+		return "", ErrUnknownAggregation
+	}
+}
+
+// CounterOnly сообщает, что функция имеет смысл только для монотонных счётчиков.
+func (a Aggregation) CounterOnly() bool {
+	return a == AggRate || a == AggIncrease
+}
+
+// GaugeOnly сообщает, что функция имеет смысл только для gauge: история counter хранит
+// накопленные значения, и их сумма или среднее ничего не означают.
+func (a Aggregation) GaugeOnly() bool {
+	return a == AggSum || a == AggAvg
+}
+
+type AggregateResult struct {
+	ID      string      `json:"id"`
+	MType   string      `json:"type"`
+	Fn      Aggregation `json:"fn"`
+	Window  string      `json:"window"`
+	Value   float64     `json:"value"`
+	Samples int         `json:"samples"`
+}
+
+// SplitWindow делит историю в хронологическом порядке на последнее значение до from и значения окна.
+// Значение до окна нужно increase и rate, чтобы учесть прирост к первому значению окна.
+func SplitWindow(history []Sample, from time.Time) (*Sample, []Sample) {
+	start := sort.Search(len(history), func(i int) bool {
+		return !history[i].Timestamp.Before(from)
+	})
+	if start == 0 {
+		return nil, history
+	}
+	return &history[start-1], history[start:]
+}
+
+// Aggregate считает функцию по значениям окна длиной window в хронологическом порядке.
+// base - последнее значение до окна, учитывается только increase и rate; nil, если его нет.
+// count, sum, increase и rate на пустом окне равны нулю, остальные функции возвращают ErrNoSamples.
+func Aggregate(fn Aggregation, base *Sample, samples []Sample, window time.Duration) (float64, error) {
+	switch fn {
+	case AggCount:
+		return float64(len(samples)), nil
+	case AggSum:
+		var sum float64
+		for _, s := range samples {
+			sum += s.Value
+		}
+		return sum, nil
+	case AggIncrease:
+		return increase(base, samples), nil
+	case AggRate:
+		if window <= 0 {
+			return 0, ErrIncorrectWindow
+		}
+		return increase(base, samples) / window.Seconds(), nil
+	case AggMin, AggMax, AggAvg, AggLast:
+	default:
+		return 0, ErrUnknownAggregation
+	}
+	if len(samples) == 0 {
+		return 0, ErrNoSamples
+	}
+	switch fn {
+	case AggMin:
+		result := math.Inf(1)
+		for _, s := range samples {
+			result = math.Min(result, s.Value)
+		}
+		return result, nil
+	case AggMax:
+		result := math.Inf(-1)
+		for _, s := range samples {
+			result = math.Max(result, s.Value)
+		}
+		return result, nil
+	case AggAvg:
+		var sum float64
+		for _, s := range samples {
+			sum += s.Value
+		}
+		return sum / float64(len(samples)), nil
+	default:
+		return samples[len(samples)-1].Value, nil
+	}
+}
+
+// increase суммирует прирост счётчика между соседними значениями, начиная от base.
+// Уменьшение значения считается сбросом: счётчик начал отсчёт с нуля,
+// поэтому прирост после сброса равен новому значению целиком.
+// Без base прирост к первому значению окна неизвестен и не учитывается.
+func increase(base *Sample, samples []Sample) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	prev := samples[0].Value
+	if base != nil {
+		prev = base.Value
+	}
+	var result float64
+	for _, s := range samples {
+		if s.Value < prev {
+			result += s.Value
+		} else {
+			result += s.Value - prev
+		}
+		prev = s.Value
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	start := time.Unix(0, 0)
+	samples := func(values ...float64) []Sample {
+		result := make([]Sample, 0, len(values))
+		for i, v := range values {
+			result = append(result, Sample{Timestamp: start.Add(time.Duration(i) * time.Second), Value: v})
+		}
+		return result
+	}
+	tests := []struct {
+		name    string
+		fn      Aggregation
+		base    *Sample
+		samples []Sample
+		window  time.Duration
+		want    float64
+		wantErr error
+	}{
+		{name: "min", fn: AggMin, samples: samples(3, 1, 2), want: 1},
+		{name: "max", fn: AggMax, samples: samples(3, 1, 2), want: 3},
+		{name: "avg", fn: AggAvg, samples: samples(3, 1, 2), want: 2},
+		{name: "sum", fn: AggSum, samples: samples(3, 1, 2), want: 6},
+		{name: "last", fn: AggLast, samples: samples(3, 1, 2), want: 2},
+		{name: "count", fn: AggCount, samples: samples(3, 1, 2), want: 3},
+		{name: "countEmpty", fn: AggCount, want: 0},
+		{name: "lastEmpty", fn: AggLast, wantErr: ErrNoSamples},
+		{name: "increase", fn: AggIncrease, samples: samples(10, 15, 20), want: 10},
+		{name: "increaseWithReset", fn: AggIncrease, samples: samples(10, 15, 3, 8), want: 5 + 3 + 5},
+		{name: "increaseResetToZero", fn: AggIncrease, samples: samples(10, 0, 4), want: 4},
+		{name: "increaseFromBase", fn: AggIncrease, base: &Sample{Value: 4}, samples: samples(10, 15), want: 11},
+		{name: "increaseSingleSample", fn: AggIncrease, base: &Sample{Value: 4}, samples: samples(10), want: 6},
+		{name: "increaseResetAfterBase", fn: AggIncrease, base: &Sample{Value: 20}, samples: samples(3, 8), want: 8},
+		{name: "increaseOnlyBase", fn: AggIncrease, base: &Sample{Value: 20}, want: 0},
+		{name: "rate", fn: AggRate, samples: samples(0, 30, 60), window: time.Minute, want: 1},
+		{name: "rateWithoutWindow", fn: AggRate, samples: samples(0, 30), wantErr: ErrIncorrectWindow},
+		{name: "unknown", fn: "median", samples: samples(1), wantErr: ErrUnknownAggregation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Aggregate(tt.fn, tt.base, tt.samples, tt.window)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
+
+func TestSplitWindow(t *testing.T) {
+	start := time.Unix(0, 0)
+	history := []Sample{
+		{Timestamp: start, Value: 1},
+		{Timestamp: start.Add(time.Minute), Value: 2},
+		{Timestamp: start.Add(2 * time.Minute), Value: 3},
+	}
+	tests := []struct {
+		name    string
+		from    time.Time
+		base    *Sample
+		samples []Sample
+	}{
+		{name: "beforeHistory", from: start.Add(-time.Minute), samples: history},
+		{name: "onSample", from: start.Add(time.Minute), base: &history[0], samples: history[1:]},
+		{name: "betweenSamples", from: start.Add(90 * time.Second), base: &history[1], samples: history[2:]},
+		{name: "afterHistory", from: start.Add(time.Hour), base: &history[2], samples: []Sample{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, samples := SplitWindow(history, tt.from)
+			assert.Equal(t, tt.base, base)
+			assert.Equal(t, tt.samples, samples)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+var ErrIncorrectRule = errors.New("incorrect alert rule")
+
+// AlertRule - условие "значение метрики Op Threshold", которое должно держаться не меньше For.
+// Правило проверяется для каждой метрики, подходящей под Selector, отдельно.
+type AlertRule struct {
+	Name      string
+	Selector  MetricQuery
+	Op        string
+	Threshold float64
+	For       time.Duration
+}
+
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrIncorrectRule)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("%w: %q: unknown comparison %q", ErrIncorrectRule, r.Name, r.Op)
+	}
+	if math.IsNaN(r.Threshold) || math.IsInf(r.Threshold, 0) {
+		return fmt.Errorf("%w: %q: threshold must be finite", ErrIncorrectRule, r.Name)
+	}
+	if r.For < 0 {
+		return fmt.Errorf("%w: %q: negative for", ErrIncorrectRule, r.Name)
+	}
+	return nil
+}
+
+// Holds проверяет условие правила для значения.
+func (r *AlertRule) Holds(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	default:
+		return false
+	}
+}
+
+// Alert - срабатывание правила для одной метрики.
+type Alert struct {
+	// Fingerprint одинаков для всех срабатываний правила по одной метрике, по нему получатель склеивает уведомления.
+	Fingerprint string     `json:"fingerprint"`
+	Rule        string     `json:"rule"`
+	State       string     `json:"state"`
+	ID          string     `json:"id"`
+	MType       string     `json:"type"`
+	Labels      Labels     `json:"labels,omitempty"`
+	Op          string     `json:"op"`
+	Threshold   float64    `json:"threshold"`
+	Value       float64    `json:"value"`
+	ActiveAt    time.Time  `json:"active_at"` // с какого момента выполняется условие
+	FiredAt     *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// NewAlert заводит срабатывание правила r по метрике m в состоянии pending.
+func NewAlert(r *AlertRule, m *Metric, now time.Time) *Alert {
+	return &Alert{
+		Fingerprint: AlertFingerprint(r.Name, m),
+		Rule:        r.Name,
+		State:       AlertPending,
+		ID:          m.ID,
+		MType:       m.MType,
+		Labels:      m.Labels,
+		Op:          r.Op,
+		Threshold:   r.Threshold,
+		Value:       m.Number(),
+		ActiveAt:    now,
+	}
+}
+
+func AlertFingerprint(rule string, m *Metric) string {
+	return rule + "/" + m.MType + "/" + m.ID + "{" + m.Labels.String() + "}"
+}
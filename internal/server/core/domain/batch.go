@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"fmt"
+	"maps"
+)
+
+// StageMetrics применяет батч к копии значений, не трогая хранилище,
+// чтобы батч мог быть записан целиком или не записан вовсе.
+// Возвращает ключи в порядке первого появления и новые значения по ним.
+// Значения не разделяют память с хранилищем, поэтому их можно отдавать наружу без копирования.
+func StageMetrics(stored map[Key]Value, metrics MetricsList) ([]Key, map[Key]Value, error) {
+	keys := make([]Key, 0, len(metrics))
+	updated := make(map[Key]Value, len(metrics))
+	for _, m := range metrics {
+		key := m.Key()
+		current, staged := updated[key]
+		if !staged {
+			keys = append(keys, key)
+			var found bool
+			if current, found = stored[key]; !found && len(m.Labels) > 0 {
+				current.Labels = maps.Clone(m.Labels)
+			}
+		}
+		next := Value{Labels: current.Labels, History: current.History, Source: m.Source}
+		switch m.MType {
+		case Counter:
+			delta := *m.Delta
+			if current.Delta != nil {
+				delta += *current.Delta
+			}
+			next.Delta = &delta
+		case Histogram:
+			histogram, err := applyHistogram(current.Histogram, &m)
+			if err != nil {
+				return nil, nil, fmt.Errorf("metric %q: %w", m.ID, err)
+			}
+			next.Histogram = histogram
+		case Summary:
+			summary, err := applySketch(current.Summary, &m)
+			if err != nil {
+				return nil, nil, fmt.Errorf("metric %q: %w", m.ID, err)
+			}
+			next.Summary = summary
+		default:
+			value := *m.Value
+			if m.Relative && current.Value != nil {
+				value += *current.Value
+			}
+			if m.Relative && m.Registered != nil {
+				if err := m.Registered.CheckValue(value); err != nil {
+					return nil, nil, err
+				}
+			}
+			next.Value = &value
+		}
+		updated[key] = next
+	}
+	return keys, updated, nil
+}
+
+func CollectMetrics(keys []Key, values map[Key]Value) MetricsList {
+	result := make(MetricsList, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, NewMetric(k, values[k]))
+	}
+	return result
+}
@@ -1,41 +1,139 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
+
+const (
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Summary   = "summary"
+)
 
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	StatusOK    = "ok"
+	StatusError = "error"
 )
 
 var (
 	ErrIncorrectMetricType  = errors.New("incorrect metric value")
 	ErrIncorrectMetricValue = errors.New("incorrect metric value")
 	ErrItemNotFound         = errors.New("item not found")
+	ErrEmptyBatch           = errors.New("empty batch of metrics")
 )
 
 type SetMetricRequest struct {
-	ID    string
-	MType string
-	Value string
+	ID     string
+	MType  string
+	Value  string
+	Labels Labels
+	Source *Source
 }
 
 type Metric struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID     string   `json:"id"`               // имя метрики
+	MType  string   `json:"type"`             // параметр, принимающий значение gauge, counter, histogram или summary
+	Delta  *int64   `json:"delta,omitempty"`  // значение метрики в случае передачи counter
+	Value  *float64 `json:"value,omitempty"`  // значение метрики в случае передачи gauge или наблюдение histogram и summary
+	Labels Labels   `json:"labels,omitempty"` // метки, отличающие метрики с одинаковым именем
+	// Histogram - границы корзин и, при передаче батча, число значений в них
+	Histogram *HistogramData `json:"histogram,omitempty"`
+	// Summary - квантильный скетч, присланный агентом уже агрегированным
+	Summary *Sketch `json:"summary,omitempty"`
+	// Source - отправитель последнего значения. Заполняет сервер, присланное клиентом значение заменяется.
+	Source *Source `json:"source,omitempty"`
+	// Stale - gauge давно не обновлялся, его значение могло потерять смысл
+	Stale bool `json:"stale,omitempty"`
+	// Relative - Value gauge прибавляется к текущему значению под блокировкой хранилища.
+	// Задаётся только сервером, например для относительных gauge StatsD.
+	Relative bool `json:"-"`
+	// Registered - описание из реестра, с диапазоном которого StageMetrics сверяет итоговое значение
+	// относительного gauge. Задаётся сервисом в строгом режиме.
+	Registered *Meta `json:"-"`
+}
+
+func (m *Metric) Key() Key {
+	return Key{MType: m.MType, ID: m.ID, Labels: m.Labels.String()}
 }
 
 type Key struct {
 	MType string
 	ID    string
+	// Labels - метки в каноническом виде Labels.String, чтобы ключ оставался сравнимым.
+	Labels string
 }
 
 type Value struct {
-	Value *float64
-	Delta *int64
+	Value     *float64
+	Delta     *int64
+	Histogram *HistogramData
+	Summary   *Sketch
+	Labels    Labels
+	History   *History
+	Updated   time.Time
+	Source    *Source
+}
+
+// NewMetric собирает метрику из ключа и значения хранилища.
+func NewMetric(k Key, v Value) Metric {
+	return Metric{
+		ID:        k.ID,
+		MType:     k.MType,
+		Value:     v.Value,
+		Delta:     v.Delta,
+		Labels:    v.Labels,
+		Histogram: v.Histogram,
+		Summary:   v.Summary,
+		Source:    v.Source,
+	}
+}
+
+// Number возвращает значение метрики числом, как Value.Number.
+func (m *Metric) Number() float64 {
+	return Value{Value: m.Value, Delta: m.Delta, Histogram: m.Histogram, Summary: m.Summary}.Number()
+}
+
+// Number возвращает значение метрики числом, для гистограммы и скетча - количество наблюдений.
+func (v Value) Number() float64 {
+	switch {
+	case v.Histogram != nil:
+		return float64(v.Histogram.Count)
+	case v.Summary != nil:
+		return float64(v.Summary.Count)
+	case v.Value != nil:
+		return *v.Value
+	case v.Delta != nil:
+		return float64(*v.Delta)
+	default:
+		return 0
+	}
+}
+
+// Clone копирует значение вместе с историей, чтобы его можно было отдать за пределы хранилища.
+func (v Value) Clone() Value {
+	v.History = v.History.Clone()
+	return v
 }
 
 type MetricValues map[Key]Value
 
+// MetricDetails - текущее значение метрики вместе со временем последнего обновления.
+type MetricDetails struct {
+	Metric
+	Updated time.Time `json:"updated"`
+}
+
 type MetricsList []Metric
+
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Health struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+)
+
+var ErrIncorrectBuckets = errors.New("incorrect histogram buckets")
+
+// DefaultBuckets - границы по умолчанию, если первое наблюдение пришло без своих.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramData - распределение значений по корзинам. Bounds - верхние границы корзин
+// по возрастанию, последняя корзина (+Inf) подразумевается, поэтому len(Counts) == len(Bounds)+1.
+// Counts хранят число значений в каждой корзине, а не накопленные суммы.
+type HistogramData struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts,omitempty"`
+	Count  uint64    `json:"count,omitempty"`
+	Sum    float64   `json:"sum,omitempty"`
+}
+
+func NewHistogramData(bounds []float64) *HistogramData {
+	return &HistogramData{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// ValidateBounds проверяет, что границы конечны и строго возрастают.
+func ValidateBounds(bounds []float64) error {
+	for i, b := range bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) || (i > 0 && b <= bounds[i-1]) {
+			return ErrIncorrectBuckets
+		}
+	}
+	return nil
+}
+
+// Validate проверяет присланный батч корзин. Пустые Counts означают, что прислана только настройка границ.
+func (h *HistogramData) Validate() error {
+	if err := ValidateBounds(h.Bounds); err != nil {
+		return err
+	}
+	if len(h.Counts) == 0 {
+		if h.Count != 0 || h.Sum != 0 {
+			return ErrIncorrectBuckets
+		}
+		return nil
+	}
+	if len(h.Counts) != len(h.Bounds)+1 || math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return ErrIncorrectBuckets
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return ErrIncorrectBuckets
+	}
+	return nil
+}
+
+func (h *HistogramData) Clone() *HistogramData {
+	if h == nil {
+		return nil
+	}
+	return &HistogramData{
+		Bounds: slices.Clone(h.Bounds),
+		Counts: slices.Clone(h.Counts),
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+func (h *HistogramData) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.Bounds, v)
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+// Merge добавляет корзины другой гистограммы с теми же границами.
+func (h *HistogramData) Merge(other *HistogramData) error {
+	if !slices.Equal(h.Bounds, other.Bounds) {
+		return ErrIncorrectBuckets
+	}
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	return nil
+}
+
+// Buckets возвращает пары "верхняя граница - число значений", последняя граница "+Inf".
+func (h *HistogramData) Buckets() []Bucket {
+	buckets := make([]Bucket, 0, len(h.Counts))
+	for i, c := range h.Counts {
+		upper := "+Inf"
+		if i < len(h.Bounds) {
+			upper = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+		}
+		buckets = append(buckets, Bucket{Upper: upper, Count: c})
+	}
+	return buckets
+}
+
+type Bucket struct {
+	Upper string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// applyHistogram применяет к текущей гистограмме присланные корзины и наблюдение,
+// не изменяя current. Границы задаются первой записью и дальше не меняются.
+func applyHistogram(current *HistogramData, m *Metric) (*HistogramData, error) {
+	var next *HistogramData
+	switch {
+	case current != nil:
+		next = current.Clone()
+	case m.Histogram != nil && m.Histogram.Bounds != nil:
+		next = NewHistogramData(m.Histogram.Bounds)
+	default:
+		next = NewHistogramData(DefaultBuckets)
+	}
+	if m.Histogram != nil {
+		if m.Histogram.Bounds != nil && !slices.Equal(next.Bounds, m.Histogram.Bounds) {
+			return nil, ErrIncorrectBuckets
+		}
+		if len(m.Histogram.Counts) > 0 {
+			if err := next.Merge(m.Histogram); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if m.Value != nil {
+		next.Observe(*m.Value)
+	}
+	return next, nil
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageMetrics_Histogram(t *testing.T) {
+	observe := func(v float64, h *HistogramData) Metric {
+		return Metric{ID: "latency", MType: Histogram, Value: &v, Histogram: h}
+	}
+	key := Key{MType: Histogram, ID: "latency"}
+	stored := map[Key]Value{}
+
+	_, updated, err := StageMetrics(stored, MetricsList{
+		observe(0.5, &HistogramData{Bounds: []float64{0.1, 1}}),
+		observe(1, nil),
+		observe(3, nil),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &HistogramData{Bounds: []float64{0.1, 1}, Counts: []uint64{0, 2, 1}, Count: 3, Sum: 4.5},
+		updated[key].Histogram)
+	stored[key] = updated[key]
+
+	_, updated, err = StageMetrics(stored, MetricsList{{ID: "latency", MType: Histogram, Histogram: &HistogramData{
+		Bounds: []float64{0.1, 1}, Counts: []uint64{4, 0, 1}, Count: 5, Sum: 2.2,
+	}}})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{4, 2, 2}, updated[key].Histogram.Counts)
+	assert.Equal(t, uint64(8), updated[key].Histogram.Count)
+	assert.Equal(t, []uint64{0, 2, 1}, stored[key].Histogram.Counts, "stored value must stay untouched")
+
+	_, _, err = StageMetrics(stored, MetricsList{observe(1, &HistogramData{Bounds: []float64{0.5}})})
+	assert.ErrorIs(t, err, ErrIncorrectBuckets)
+}
+
+func TestHistogramData_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    HistogramData
+		wantErr bool
+	}{
+		{name: "boundsOnly", data: HistogramData{Bounds: []float64{1, 2}}},
+		{name: "batch", data: HistogramData{Bounds: []float64{1}, Counts: []uint64{1, 2}, Count: 3, Sum: 4}},
+		{name: "unsorted", data: HistogramData{Bounds: []float64{2, 1}}, wantErr: true},
+		{name: "countsLength", data: HistogramData{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1}, wantErr: true},
+		{name: "countMismatch", data: HistogramData{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.data.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrIncorrectBuckets)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
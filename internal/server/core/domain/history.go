@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrHistoryDisabled = errors.New("metric history is disabled")
+
+type Sample struct {
+	Timestamp time.Time `json:"ts"`
+	Value     float64   `json:"value"`
+}
+
+// History - кольцевой буфер последних значений метрики фиксированной ёмкости.
+// Не потокобезопасен: хранилища обращаются к нему под своим мьютексом.
+type History struct {
+	samples []Sample
+	start   int
+	size    int
+}
+
+func NewHistory(capacity int) *History {
+	return &History{
+		samples: make([]Sample, capacity),
+	}
+}
+
+func (h *History) Add(s Sample) {
+	if len(h.samples) == 0 {
+		return
+	}
+	if h.size < len(h.samples) {
+		h.samples[(h.start+h.size)%len(h.samples)] = s
+		h.size++
+		return
+	}
+	h.samples[h.start] = s
+	h.start = (h.start + 1) % len(h.samples)
+}
+
+// TrimBefore выбрасывает значения старше t.
+func (h *History) TrimBefore(t time.Time) {
+	for h.size > 0 && h.samples[h.start].Timestamp.Before(t) {
+		h.samples[h.start] = Sample{}
+		h.start = (h.start + 1) % len(h.samples)
+		h.size--
+	}
+}
+
+// Range возвращает копию значений из [from, to] в хронологическом порядке.
+// Нулевые from и to не ограничивают диапазон.
+func (h *History) Range(from, to time.Time) []Sample {
+	result := make([]Sample, 0, h.size)
+	for i := 0; i < h.size; i++ {
+		s := h.samples[(h.start+i)%len(h.samples)]
+		if !from.IsZero() && s.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && s.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func (h *History) Clone() *History {
+	if h == nil {
+		return nil
+	}
+	return &History{
+		samples: append([]Sample(nil), h.samples...),
+		start:   h.start,
+		size:    h.size,
+	}
+}
+
+// Retention задаёт, сколько значений и как долго хранить в истории метрики.
+// Size <= 0 отключает историю, MaxAge <= 0 снимает ограничение по возрасту.
+type Retention struct {
+	Size   int
+	MaxAge time.Duration
+}
+
+func (r Retention) Enabled() bool {
+	return r.Size > 0
+}
+
+// Record добавляет значение в историю, создавая её при первой записи.
+func (r Retention) Record(h *History, v Value, now time.Time) *History {
+	if !r.Enabled() {
+		return nil
+	}
+	if h == nil {
+		h = NewHistory(r.Size)
+	}
+	h.Add(Sample{Timestamp: now, Value: v.Number()})
+	if r.MaxAge > 0 {
+		h.TrimBefore(now.Add(-r.MaxAge))
+	}
+	return h
+}
+
+// Rebuild перекладывает восстановленные из файла значения в буфер с текущими настройками.
+func (r Retention) Rebuild(samples []Sample, now time.Time) *History {
+	if !r.Enabled() || len(samples) == 0 {
+		return nil
+	}
+	h := NewHistory(r.Size)
+	for _, s := range samples {
+		h.Add(s)
+	}
+	if r.MaxAge > 0 {
+		h.TrimBefore(now.Add(-r.MaxAge))
+	}
+	return h
+}
+
+// Downsample оставляет по последнему значению на каждый интервал step, отсчитывая от первого значения.
+func Downsample(samples []Sample, step time.Duration) []Sample {
+	if step <= 0 || len(samples) == 0 {
+		return samples
+	}
+	origin := samples[0].Timestamp
+	result := make([]Sample, 0, len(samples))
+	lastBucket := int64(-1)
+	for _, s := range samples {
+		bucket := int64(s.Timestamp.Sub(origin) / step)
+		if bucket == lastBucket {
+			result[len(result)-1] = s
+			continue
+		}
+		result = append(result, s)
+		lastBucket = bucket
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrIncorrectLabels = errors.New("incorrect metric labels")
+
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels - метки метрики. Метрики с одинаковым именем, но разными метками хранятся раздельно.
+type Labels map[string]string
+
+// reservedLabels добавляет сервер при выгрузке гистограмм и summary в формате Prometheus.
+var reservedLabels = map[string]struct{}{"le": {}, "quantile": {}}
+
+// Validate проверяет имена меток. Зарезервированы le, quantile и имена с префиксом "__",
+// который Prometheus оставляет для внутренних меток.
+func (l Labels) Validate() error {
+	for name := range l {
+		if !labelName.MatchString(name) {
+			return fmt.Errorf("%w: bad name %q", ErrIncorrectLabels, name)
+		}
+		if _, found := reservedLabels[name]; found || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("%w: name %q is reserved", ErrIncorrectLabels, name)
+		}
+	}
+	return nil
+}
+
+// String возвращает канонический вид меток: пары name=value через запятую, отсортированные по имени.
+// Запятая и обратная косая черта в значениях экранируются. Пустые метки дают пустую строку.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		for _, r := range l[name] {
+			if r == ',' || r == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Contains проверяет, что все метки selector есть среди l с теми же значениями.
+func (l Labels) Contains(selector Labels) bool {
+	for name, value := range selector {
+		if v, ok := l[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabels разбирает метки в каноническом виде Labels.String.
+func ParseLabels(s string) (Labels, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(Labels)
+	var (
+		pair    strings.Builder
+		escaped bool
+	)
+	add := func() error {
+		name, value, found := strings.Cut(pair.String(), "=")
+		if !found || !labelName.MatchString(name) {
+			return ErrIncorrectLabels
+		}
+		if _, dup := labels[name]; dup {
+			return ErrIncorrectLabels
+		}
+		labels[name] = value
+		pair.Reset()
+		return nil
+	}
+	for _, r := range s {
+		switch {
+		case escaped:
+			pair.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			if err := add(); err != nil {
+				return nil, err
+			}
+		default:
+			pair.WriteRune(r)
+		}
+	}
+	if escaped {
+		return nil, ErrIncorrectLabels
+	}
+	if err := add(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
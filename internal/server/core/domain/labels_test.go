@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		name      string
+		labels    Labels
+		canonical string
+	}{
+		{name: "empty", labels: nil, canonical: ""},
+		{name: "sorted", labels: Labels{"host": "a", "dc": "eu"}, canonical: "dc=eu,host=a"},
+		{name: "escaped", labels: Labels{"path": `a,b\c=d`}, canonical: `path=a\,b\\c=d`},
+		{name: "emptyValue", labels: Labels{"host": ""}, canonical: "host="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.canonical, tt.labels.String())
+			parsed, err := ParseLabels(tt.canonical)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.labels, parsed)
+		})
+	}
+	for _, bad := range []string{"host", "1host=a", "host=a,host=b", `host=a\`, ","} {
+		_, err := ParseLabels(bad)
+		assert.ErrorIs(t, err, ErrIncorrectLabels, bad)
+	}
+	for _, reserved := range []Labels{{"le": "1"}, {"quantile": "0.5"}, {"__name__": "x"}, {"__": "x"}} {
+		assert.ErrorIs(t, reserved.Validate(), ErrIncorrectLabels, reserved.String())
+	}
+	assert.NoError(t, Labels{"_host": "a", "level": "info"}.Validate())
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var (
+	ErrIncorrectMeta      = errors.New("incorrect metric metadata")
+	ErrUnregisteredMetric = errors.New("metric is not registered")
+	ErrMetaMismatch       = errors.New("metric does not match registered type")
+	ErrValueOutOfRange    = errors.New("metric value is out of registered range")
+)
+
+// Meta - описание метрики в реестре. Относится к имени метрики, поэтому общее для всех её меток.
+type Meta struct {
+	Name        string   `json:"name"`
+	MType       string   `json:"type"`
+	Unit        string   `json:"unit,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Min         *float64 `json:"min,omitempty"` // нижняя граница значений, nil - не ограничена
+	Max         *float64 `json:"max,omitempty"` // верхняя граница значений, nil - не ограничена
+}
+
+// Registry - описания метрик по имени.
+type Registry map[string]Meta
+
+func (m *Meta) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrIncorrectMeta)
+	}
+	switch m.MType {
+	case Gauge, Counter, Histogram, Summary:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrIncorrectMeta, m.MType)
+	}
+	for _, bound := range []*float64{m.Min, m.Max} {
+		if bound != nil && (math.IsNaN(*bound) || math.IsInf(*bound, 0)) {
+			return fmt.Errorf("%w: range bounds must be finite", ErrIncorrectMeta)
+		}
+	}
+	if m.Min != nil && m.Max != nil && *m.Min > *m.Max {
+		return fmt.Errorf("%w: min is greater than max", ErrIncorrectMeta)
+	}
+	return nil
+}
+
+// Check сверяет метрику с описанием: тип должен совпадать, а присланные значения - попадать в диапазон.
+// Для counter проверяется приращение, для histogram и summary - наблюдение или границы присланного скетча.
+// Относительный gauge сверяется с диапазоном в StageMetrics, когда известно итоговое значение.
+func (m *Meta) Check(metric *Metric) error {
+	if metric.MType != m.MType {
+		return fmt.Errorf("%w: %q is %s, got %s", ErrMetaMismatch, m.Name, m.MType, metric.MType)
+	}
+	if (m.Min == nil && m.Max == nil) || metric.Relative {
+		return nil
+	}
+	values := make([]float64, 0, 2)
+	switch {
+	case metric.Value != nil:
+		values = append(values, *metric.Value)
+	case metric.Delta != nil:
+		values = append(values, float64(*metric.Delta))
+	case metric.Summary != nil && metric.Summary.Count > 0:
+		values = append(values, metric.Summary.Min, metric.Summary.Max)
+	}
+	for _, v := range values {
+		if err := m.CheckValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckValue проверяет, что значение попадает в диапазон описания.
+func (m *Meta) CheckValue(v float64) error {
+	if (m.Min != nil && v < *m.Min) || (m.Max != nil && v > *m.Max) {
+		return fmt.Errorf("%w: %q got %v, allowed %s", ErrValueOutOfRange, m.Name, v, m.formatRange())
+	}
+	return nil
+}
+
+func (m *Meta) formatRange() string {
+	low, high := "-inf", "+inf"
+	if m.Min != nil {
+		low = fmt.Sprint(*m.Min)
+	}
+	if m.Max != nil {
+		high = fmt.Sprint(*m.Max)
+	}
+	return "[" + low + ", " + high + "]"
+}
+
+// List возвращает описания, упорядоченные по имени.
+func (r Registry) List() []Meta {
+	list := make([]Meta, 0, len(r))
+	for _, meta := range r {
+		list = append(list, meta)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeta_Check(t *testing.T) {
+	low, high := 0.0, 100.0
+	meta := Meta{Name: "cpu", MType: Gauge, Min: &low, Max: &high}
+	value := func(v float64) *float64 {
+		return &v
+	}
+	sketch := NewSketch(DefaultSketchAccuracy)
+	sketch.Add(10)
+	sketch.Add(120)
+	tests := []struct {
+		name   string
+		meta   Meta
+		metric Metric
+		err    error
+	}{
+		{name: "inRange", meta: meta, metric: Metric{ID: "cpu", MType: Gauge, Value: value(100)}},
+		{name: "aboveRange", meta: meta, metric: Metric{ID: "cpu", MType: Gauge, Value: value(100.5)}, err: ErrValueOutOfRange},
+		{name: "wrongType", meta: meta, metric: Metric{ID: "cpu", MType: Counter, Value: value(1)}, err: ErrMetaMismatch},
+		{name: "unbounded", meta: Meta{Name: "cpu", MType: Gauge}, metric: Metric{ID: "cpu", MType: Gauge, Value: value(-1)}},
+		{name: "relativeLeftToStaging", meta: meta,
+			metric: Metric{ID: "cpu", MType: Gauge, Value: value(150), Relative: true}},
+		{name: "relativeWrongType", meta: meta,
+			metric: Metric{ID: "cpu", MType: Counter, Relative: true}, err: ErrMetaMismatch},
+		{name: "sketchMax", meta: Meta{Name: "cpu", MType: Summary, Min: &low, Max: &high},
+			metric: Metric{ID: "cpu", MType: Summary, Summary: sketch}, err: ErrValueOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.meta.Check(&tt.metric)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
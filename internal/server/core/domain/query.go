@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"cmp"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	SortByID    = "id"
+	SortByType  = "type"
+	SortByValue = "value"
+)
+
+type MetricQuery struct {
+	MType  string
+	Prefix string
+	Glob   string
+	Regex  *regexp.Regexp
+	// Labels - селектор: метрика подходит, если у неё есть все эти метки с теми же значениями.
+	Labels Labels
+	SortBy string
+	Desc   bool
+	Limit  int
+	// After - последняя метрика предыдущей страницы, выдача начинается строго после неё.
+	After *Metric
+}
+
+type MetricPage struct {
+	Metrics MetricsList
+	HasMore bool
+}
+
+// Match проверяет фильтры запроса. Хранилища вызывают его при обходе,
+// чтобы не копировать неподходящие метрики.
+func (q *MetricQuery) Match(mType, id string, labels Labels) bool {
+	if q.MType != "" && q.MType != mType {
+		return false
+	}
+	if q.Prefix != "" && !strings.HasPrefix(id, q.Prefix) {
+		return false
+	}
+	if q.Glob != "" {
+		if matched, _ := path.Match(q.Glob, id); !matched {
+			return false
+		}
+	}
+	if q.Regex != nil && !q.Regex.MatchString(id) {
+		return false
+	}
+	return labels.Contains(q.Labels)
+}
+
+func numericValue(m *Metric) float64 {
+	return Value{Value: m.Value, Delta: m.Delta}.Number()
+}
+
+// Compare задаёт полный порядок метрик для сортировки и курсора.
+func (q *MetricQuery) Compare(a, b *Metric) int {
+	var c int
+	switch q.SortBy {
+	case SortByType:
+		c = cmp.Or(cmp.Compare(a.MType, b.MType), cmp.Compare(a.ID, b.ID))
+	case SortByValue:
+		c = cmp.Or(cmp.Compare(numericValue(a), numericValue(b)), cmp.Compare(a.ID, b.ID))
+	default:
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	c = cmp.Or(c, cmp.Compare(a.MType, b.MType), cmp.Compare(a.Labels.String(), b.Labels.String()))
+	if q.Desc {
+		return -c
+	}
+	return c
+}
+
+// Paginate сортирует уже отфильтрованные метрики и вырезает страницу после курсора.
+func (q *MetricQuery) Paginate(metrics MetricsList) MetricPage {
+	slices.SortFunc(metrics, func(a, b Metric) int {
+		return q.Compare(&a, &b)
+	})
+	if q.After != nil {
+		start, _ := slices.BinarySearchFunc(metrics, q.After, func(m Metric, after *Metric) int {
+			if q.Compare(&m, after) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		metrics = metrics[start:]
+	}
+	if q.Limit > 0 && len(metrics) > q.Limit {
+		return MetricPage{Metrics: metrics[:q.Limit], HasMore: true}
+	}
+	return MetricPage{Metrics: metrics}
+}
@@ -0,0 +1,231 @@
+package domain
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"slices"
+)
+
+var (
+	ErrIncorrectSketch   = errors.New("incorrect summary sketch")
+	ErrIncorrectQuantile = errors.New("quantile must be between 0 and 1")
+)
+
+// DefaultSketchAccuracy - относительная точность квантилей, если первая запись пришла без своей.
+const DefaultSketchAccuracy = 0.01
+
+// DefaultQuantiles - квантили, которые отдаются, если клиент не запросил свои.
+var DefaultQuantiles = []float64{0.5, 0.95, 0.99}
+
+// Sketch - квантильный скетч DDSketch. Значения раскладываются по логарифмическим корзинам
+// так, что любой квантиль восстанавливается с относительной ошибкой не больше Alpha.
+// Скетчи с одинаковой Alpha сливаются сложением корзин без потери точности.
+// Positive и Negative хранят число значений по индексу корзины, для отрицательных - по модулю.
+type Sketch struct {
+	Alpha    float64        `json:"alpha"`
+	Positive map[int]uint64 `json:"positive,omitempty"`
+	Negative map[int]uint64 `json:"negative,omitempty"`
+	Zero     uint64         `json:"zero,omitempty"`
+	Count    uint64         `json:"count,omitempty"`
+	Sum      float64        `json:"sum,omitempty"`
+	Min      float64        `json:"min,omitempty"`
+	Max      float64        `json:"max,omitempty"`
+}
+
+func NewSketch(alpha float64) *Sketch {
+	return &Sketch{
+		Alpha: alpha,
+	}
+}
+
+func (s *Sketch) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+// minIndexable - значения по модулю меньше считаются нулём, чтобы индексы корзин оставались конечными.
+const minIndexable = 1e-300
+
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// value возвращает представителя корзины, относительная ошибка которого не больше Alpha.
+func (s *Sketch) value(index int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(index)) / (g + 1)
+}
+
+// Validate проверяет присланный скетч. Скетч без значений означает, что прислана только настройка точности.
+func (s *Sketch) Validate() error {
+	if !(s.Alpha > 0 && s.Alpha < 1) {
+		return ErrIncorrectSketch
+	}
+	total := s.Zero
+	for _, bins := range []map[int]uint64{s.Positive, s.Negative} {
+		for _, c := range bins {
+			total += c
+		}
+	}
+	if total != s.Count {
+		return ErrIncorrectSketch
+	}
+	for _, v := range []float64{s.Sum, s.Min, s.Max} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ErrIncorrectSketch
+		}
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return ErrIncorrectSketch
+	}
+	return nil
+}
+
+func (s *Sketch) Clone() *Sketch {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Positive = maps.Clone(s.Positive)
+	c.Negative = maps.Clone(s.Negative)
+	return &c
+}
+
+func (s *Sketch) Add(v float64) {
+	switch {
+	case v >= minIndexable:
+		s.Positive = addBin(s.Positive, s.index(v), 1)
+	case v <= -minIndexable:
+		s.Negative = addBin(s.Negative, s.index(-v), 1)
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+}
+
+// Merge добавляет значения другого скетча с той же точностью.
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.Alpha != other.Alpha {
+		return ErrIncorrectSketch
+	}
+	if other.Count == 0 {
+		return nil
+	}
+	for i, c := range other.Positive {
+		s.Positive = addBin(s.Positive, i, c)
+	}
+	for i, c := range other.Negative {
+		s.Negative = addBin(s.Negative, i, c)
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Zero += other.Zero
+	s.Count += other.Count
+	s.Sum += other.Sum
+	return nil
+}
+
+// Quantile возвращает оценку квантиля q. Для пустого скетча возвращает ErrNoSamples.
+func (s *Sketch) Quantile(q float64) (float64, error) {
+	if math.IsNaN(q) || q < 0 || q > 1 {
+		return 0, ErrIncorrectQuantile
+	}
+	if s.Count == 0 {
+		return 0, ErrNoSamples
+	}
+	rank := uint64(q * float64(s.Count-1))
+	var seen uint64
+	// Отрицательные значения идут от больших по модулю к меньшим.
+	negative := sortedIndexes(s.Negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		seen += s.Negative[negative[i]]
+		if seen > rank {
+			return s.clamp(-s.value(negative[i])), nil
+		}
+	}
+	seen += s.Zero
+	if seen > rank {
+		return 0, nil
+	}
+	for _, index := range sortedIndexes(s.Positive) {
+		seen += s.Positive[index]
+		if seen > rank {
+			return s.clamp(s.value(index)), nil
+		}
+	}
+	return s.Max, nil
+}
+
+// addBin увеличивает корзину, создавая набор корзин при первом значении:
+// пустой набор всегда nil, чтобы скетч не менялся при сохранении в JSON и чтении обратно.
+func addBin(bins map[int]uint64, index int, count uint64) map[int]uint64 {
+	if count == 0 {
+		return bins
+	}
+	if bins == nil {
+		bins = make(map[int]uint64)
+	}
+	bins[index] += count
+	return bins
+}
+
+func sortedIndexes(bins map[int]uint64) []int {
+	indexes := make([]int, 0, len(bins))
+	for i := range bins {
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// clamp не даёт оценке выйти за реально наблюдавшиеся минимум и максимум.
+func (s *Sketch) clamp(v float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
+
+// applySketch применяет к текущему скетчу присланный скетч и наблюдение, не изменяя current.
+// Точность задаётся первой записью и дальше не меняется.
+func applySketch(current *Sketch, m *Metric) (*Sketch, error) {
+	var next *Sketch
+	switch {
+	case current != nil:
+		next = current.Clone()
+	case m.Summary != nil:
+		next = NewSketch(m.Summary.Alpha)
+	default:
+		next = NewSketch(DefaultSketchAccuracy)
+	}
+	if m.Summary != nil {
+		if err := next.Merge(m.Summary); err != nil {
+			return nil, err
+		}
+	}
+	if m.Value != nil {
+		next.Add(*m.Value)
+	}
+	return next, nil
+}
+
+type Quantile struct {
+	Quantile float64 `json:"q"`
+	Value    float64 `json:"value"`
+}
+
+type QuantileResult struct {
+	ID        string     `json:"id"`
+	Labels    Labels     `json:"labels,omitempty"`
+	Count     uint64     `json:"count"`
+	Sum       float64    `json:"sum"`
+	Quantiles []Quantile `json:"quantiles"`
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketch_Quantile(t *testing.T) {
+	whole, left, right := NewSketch(DefaultSketchAccuracy), NewSketch(DefaultSketchAccuracy), NewSketch(DefaultSketchAccuracy)
+	for v := 1; v <= 1000; v++ {
+		whole.Add(float64(v))
+		if v%2 == 0 {
+			left.Add(float64(v))
+		} else {
+			right.Add(float64(v))
+		}
+	}
+	assert.NoError(t, left.Merge(right))
+	assert.Equal(t, whole, left, "merge must be exact")
+
+	for _, q := range []float64{0, 0.5, 0.95, 0.99, 1} {
+		exact := math.Max(1, math.Floor(q*999)+1)
+		got, err := whole.Quantile(q)
+		assert.NoError(t, err)
+		assert.InEpsilon(t, exact, got, DefaultSketchAccuracy, "q=%v", q)
+	}
+
+	mixed := NewSketch(DefaultSketchAccuracy)
+	for _, v := range []float64{-100, -10, 0, 10, 100} {
+		mixed.Add(v)
+	}
+	median, err := mixed.Quantile(0.5)
+	assert.NoError(t, err)
+	assert.Zero(t, median)
+	low, err := mixed.Quantile(0)
+	assert.NoError(t, err)
+	assert.InEpsilon(t, -100, low, DefaultSketchAccuracy)
+
+	_, err = mixed.Quantile(1.5)
+	assert.ErrorIs(t, err, ErrIncorrectQuantile)
+	_, err = NewSketch(DefaultSketchAccuracy).Quantile(0.5)
+	assert.ErrorIs(t, err, ErrNoSamples)
+	assert.ErrorIs(t, whole.Merge(NewSketch(0.05)), ErrIncorrectSketch)
+}
+
+func TestSketch_JSON(t *testing.T) {
+	s := NewSketch(0.02)
+	for _, v := range []float64{-3, 0, 0.5, 7, 7, 1e6} {
+		s.Add(v)
+	}
+	data, err := json.Marshal(s)
+	assert.NoError(t, err)
+	var decoded Sketch
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.NoError(t, decoded.Validate())
+	assert.Equal(t, s, &decoded)
+}
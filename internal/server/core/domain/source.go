@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"net"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Source - кто и когда прислал последнее значение метрики.
+type Source struct {
+	Address   string    `json:"address,omitempty"`  // адрес отправителя без порта
+	AgentID   string    `json:"agent_id,omitempty"` // идентификатор, который агент передал сам
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NewSource описывает запись, полученную сейчас. Порт из адреса отбрасывается,
+// чтобы переподключения агента не выглядели как новые источники.
+func NewSource(address, agentID string) *Source {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	return &Source{
+		Address:   address,
+		AgentID:   agentID,
+		Timestamp: time.Now(),
+	}
+}
+
+// Name - по чему различаются агенты: идентификатор, если он передан, иначе адрес.
+func (s *Source) Name() string {
+	if s.AgentID != "" {
+		return s.AgentID
+	}
+	return s.Address
+}
+
+type AgentMetric struct {
+	ID     string `json:"id"`
+	MType  string `json:"type"`
+	Labels Labels `json:"labels,omitempty"`
+}
+
+// Agent - отправитель метрик и метрики, последнее значение которых пришло от него.
+type Agent struct {
+	ID       string        `json:"id"`
+	Address  string        `json:"address,omitempty"`
+	LastSeen time.Time     `json:"last_seen"`
+	Metrics  []AgentMetric `json:"metrics"`
+}
+
+// CollectAgents группирует метрики по источнику последней записи. Метрика, которую пишут
+// несколько агентов, относится к тому, кто писал последним. Метрики без источника пропускаются.
+func CollectAgents(metrics MetricsList) []Agent {
+	q := MetricQuery{SortBy: SortByType}
+	slices.SortFunc(metrics, func(a, b Metric) int {
+		return q.Compare(&a, &b)
+	})
+	index := make(map[string]int)
+	agents := make([]Agent, 0)
+	for _, m := range metrics {
+		if m.Source == nil {
+			continue
+		}
+		name := m.Source.Name()
+		i, found := index[name]
+		if !found {
+			i = len(agents)
+			index[name] = i
+			agents = append(agents, Agent{ID: name, Metrics: make([]AgentMetric, 0)})
+		}
+		agent := &agents[i]
+		if m.Source.Timestamp.After(agent.LastSeen) {
+			agent.LastSeen = m.Source.Timestamp
+			agent.Address = m.Source.Address
+		}
+		agent.Metrics = append(agent.Metrics, AgentMetric{ID: m.ID, MType: m.MType, Labels: m.Labels})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].ID < agents[j].ID
+	})
+	return agents
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrIncorrectTTL = errors.New("incorrect ttl rule")
+
+// TTLRule - срок, после которого gauge с подходящим под шаблон path.Match именем считается устаревшим.
+type TTLRule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// Staleness задаёт, когда gauge без обновлений считается устаревшим и когда удаляется из хранилища.
+// Нулевое значение отключает и то и другое.
+type Staleness struct {
+	TTL   time.Duration // срок по умолчанию, 0 - не устаревают
+	Rules []TTLRule     // первое подходящее правило важнее TTL
+	Evict time.Duration // срок, после которого gauge удаляется, 0 - не удаляются
+}
+
+// ParseTTLRules разбирает правила вида "pattern=seconds", перечисленные через запятую.
+func ParseTTLRules(s string) ([]TTLRule, error) {
+	if s == "" {
+		return nil, nil
+	}
+	rules := make([]TTLRule, 0)
+	for _, part := range strings.Split(s, ",") {
+		pattern, seconds, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found || pattern == "" {
+			return nil, fmt.Errorf("%w: %q", ErrIncorrectTTL, part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: bad pattern %q", ErrIncorrectTTL, pattern)
+		}
+		ttl, err := strconv.Atoi(seconds)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("%w: bad ttl %q", ErrIncorrectTTL, seconds)
+		}
+		rules = append(rules, TTLRule{Pattern: pattern, TTL: time.Duration(ttl) * time.Second})
+	}
+	return rules, nil
+}
+
+// TTLFor возвращает срок устаревания для gauge с именем id.
+func (s Staleness) TTLFor(id string) time.Duration {
+	for _, rule := range s.Rules {
+		if matched, _ := path.Match(rule.Pattern, id); matched {
+			return rule.TTL
+		}
+	}
+	return s.TTL
+}
+
+// Stale сообщает, что gauge не обновлялся дольше своего срока.
+// Значения без времени обновления, например из старых снапшотов, устаревшими не считаются.
+func (s Staleness) Stale(k Key, v Value, now time.Time) bool {
+	if k.MType != Gauge || v.Updated.IsZero() {
+		return false
+	}
+	ttl := s.TTLFor(k.ID)
+	return ttl > 0 && now.Sub(v.Updated) > ttl
+}
+
+// Expired сообщает, что gauge пора удалить из хранилища.
+func (s Staleness) Expired(k Key, v Value, now time.Time) bool {
+	if k.MType != Gauge || v.Updated.IsZero() || s.Evict <= 0 {
+		return false
+	}
+	return now.Sub(v.Updated) > s.Evict
+}
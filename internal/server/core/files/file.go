@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"metrics/internal/server/core/domain"
 	"metrics/internal/server/logger"
@@ -14,7 +15,21 @@ import (
 	"go.uber.org/zap"
 )
 
-func SaveMetricsToFile(filepath string, metrics domain.MetricValues) error {
+// record - формат метрики в файле снапшота. История и время обновления пишутся рядом со значением,
+// поэтому старые снапшоты без них читаются как раньше.
+type record struct {
+	domain.Metric
+	Updated *time.Time      `json:"updated,omitempty"`
+	History []domain.Sample `json:"history,omitempty"`
+}
+
+// snapshot - формат файла снапшота. Раньше файл был массивом метрик, такие файлы читаются как снапшот без реестра.
+type snapshot struct {
+	Metrics []record      `json:"metrics"`
+	Meta    []domain.Meta `json:"meta,omitempty"`
+}
+
+func SaveMetricsToFile(filepath string, metrics domain.MetricValues, registry domain.Registry) error {
 	file, err := os.Create(filepath)
 	if err != nil {
 		return fmt.Errorf("failed to create a file %w", err)
@@ -24,48 +39,67 @@ func SaveMetricsToFile(filepath string, metrics domain.MetricValues) error {
 			logger.Log.Error("failed to close file: %w", zap.Error(err))
 		}
 	}(file)
-	metricList := make(domain.MetricsList, 0)
+	records := make([]record, 0, len(metrics))
 	for k, v := range metrics {
-		metricList = append(metricList, domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
-		})
+		r := record{
+			Metric: domain.NewMetric(k, v),
+		}
+		if !v.Updated.IsZero() {
+			r.Updated = &v.Updated
+		}
+		if v.History != nil {
+			r.History = v.History.Range(time.Time{}, time.Time{})
+		}
+		records = append(records, r)
 	}
-	if err = json.NewEncoder(file).Encode(metricList); err != nil {
+	if err = json.NewEncoder(file).Encode(snapshot{Metrics: records, Meta: registry.List()}); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 	return nil
 }
 
-func LoadMetricsFromFile(filepath string) (domain.MetricValues, error) {
-	var (
-		metricList domain.MetricsList
-	)
+func LoadMetricsFromFile(filepath string) (domain.MetricValues, domain.Registry, error) {
 	if _, err := os.Stat(filepath); errors.Is(err, os.ErrNotExist) {
 		f, err := os.Create(filepath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create file: %w", err)
+			return nil, nil, fmt.Errorf("failed to create file: %w", err)
 		}
 		err = f.Close()
 		if err != nil {
-			return nil, fmt.Errorf("failed to close file: %w", err)
+			return nil, nil, fmt.Errorf("failed to close file: %w", err)
 		}
 	}
 	data, err := os.ReadFile(filepath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
 	}
-	if err = json.NewDecoder(bytes.NewReader(data)).Decode(&metricList); err != nil {
-		if !errors.Is(err, io.EOF) {
-			return nil, fmt.Errorf("failed to decode file: %w", err)
-		}
-		return make(domain.MetricValues), nil
+	data = bytes.TrimSpace(data)
+	var content snapshot
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &content.Metrics)
+	} else {
+		err = json.NewDecoder(bytes.NewReader(data)).Decode(&content)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("failed to decode file: %w", err)
+	}
+	registry := make(domain.Registry, len(content.Meta))
+	for _, meta := range content.Meta {
+		registry[meta.Name] = meta
 	}
 	metricValues := make(domain.MetricValues)
-	for _, v := range metricList {
-		metricValues[domain.Key{MType: v.MType, ID: v.ID}] = domain.Value{Value: v.Value, Delta: v.Delta}
+	for _, r := range content.Metrics {
+		value := domain.Value{Value: r.Value, Delta: r.Delta, Histogram: r.Histogram, Summary: r.Summary, Labels: r.Labels, Source: r.Source}
+		if r.Updated != nil {
+			value.Updated = *r.Updated
+		}
+		if len(r.History) > 0 {
+			value.History = domain.NewHistory(len(r.History))
+			for _, sample := range r.History {
+				value.History.Add(sample)
+			}
+		}
+		metricValues[r.Key()] = value
 	}
-	return metricValues, nil
+	return metricValues, registry, nil
 }
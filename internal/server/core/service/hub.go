@@ -0,0 +1,79 @@
+package service
+
+import (
+	"sync"
+
+	"metrics/internal/server/core/domain"
+)
+
+const subscriberBuffer = 256
+
+// Subscription - подписка на изменения метрик. Канал C закрывается,
+// когда подписчик отстаёт больше чем на размер буфера или отписывается сам.
+type Subscription struct {
+	C      <-chan domain.Metric
+	ch     chan domain.Metric
+	filter *domain.MetricQuery
+}
+
+// Hub рассылает изменённые метрики подписчикам. Публикация никогда не блокируется:
+// медленный подписчик отключается, чтобы не задерживать запись метрик.
+type Hub struct {
+	mux         sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe подписывает на метрики, подходящие под filter. nil filter пропускает все метрики.
+func (h *Hub) Subscribe(filter *domain.MetricQuery) *Subscription {
+	ch := make(chan domain.Metric, subscriberBuffer)
+	sub := &Subscription{
+		C:      ch,
+		ch:     ch,
+		filter: filter,
+	}
+	h.mux.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mux.Unlock()
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.drop(sub)
+}
+
+func (h *Hub) Publish(metrics ...domain.Metric) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for sub := range h.subscribers {
+		for _, m := range metrics {
+			if sub.filter != nil && !sub.filter.Match(m.MType, m.ID, m.Labels) {
+				continue
+			}
+			select {
+			case sub.ch <- m:
+			default:
+				h.drop(sub)
+			}
+			if _, ok := h.subscribers[sub]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// drop удаляет подписчика и закрывает его канал. Вызывается под h.mux.
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.ch)
+}
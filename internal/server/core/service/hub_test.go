@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/server/core/domain"
+)
+
+func TestHub(t *testing.T) {
+	value := 1.0
+	gauge := func(id string) domain.Metric {
+		return domain.Metric{ID: id, MType: domain.Gauge, Value: &value}
+	}
+	hub := NewHub()
+	all := hub.Subscribe(nil)
+	heap := hub.Subscribe(&domain.MetricQuery{Prefix: "Heap"})
+
+	hub.Publish(gauge("Alloc"), gauge("HeapAlloc"))
+	assert.Equal(t, "Alloc", (<-all.C).ID)
+	assert.Equal(t, "HeapAlloc", (<-all.C).ID)
+	assert.Equal(t, "HeapAlloc", (<-heap.C).ID)
+	assert.Empty(t, heap.C)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Publish(gauge("Alloc"))
+	}
+	drained := 0
+	for range all.C {
+		drained++
+	}
+	assert.Equal(t, subscriberBuffer, drained, "slow subscriber must be disconnected")
+
+	hub.Publish(gauge("HeapSys"))
+	assert.Equal(t, "HeapSys", (<-heap.C).ID)
+	hub.Unsubscribe(heap)
+	hub.Unsubscribe(heap)
+	_, ok := <-heap.C
+	assert.False(t, ok)
+}
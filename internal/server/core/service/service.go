@@ -1,8 +1,11 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"sync"
 	"time"
 
 	"metrics/internal/server/config"
@@ -14,20 +17,49 @@ import (
 )
 
 type MetricStorage interface {
-	GetMetric(mType, mName string) (*domain.Metric, error)
+	GetMetric(key domain.Key) (*domain.Metric, error)
+	GetMetricDetails(key domain.Key) (*domain.MetricDetails, error)
 	SetMetric(m *domain.Metric) (*domain.Metric, error)
+	SetMetrics(metrics domain.MetricsList) (domain.MetricsList, error)
 	GetAllMetrics() (domain.MetricsList, error)
+	QueryMetrics(q *domain.MetricQuery) (domain.MetricPage, error)
+	DeleteMetric(key domain.Key) error
+	DeleteMetrics(q *domain.MetricQuery) (int, error)
+	EvictStale(now time.Time) (int, error)
+	ResetCounter(key domain.Key) (*domain.Metric, error)
+	GetHistory(key domain.Key, from, to time.Time) ([]domain.Sample, error)
+	SetMeta(meta *domain.Meta) error
+	GetMeta(name string) (*domain.Meta, error)
+	GetAllMeta() (domain.Registry, error)
+	Snapshot() (domain.MetricValues, domain.Registry, error)
+	Restore(metrics domain.MetricValues, registry domain.Registry) error
+	Health() domain.HealthCheck
 }
 
+const (
+	minSweepInterval = time.Second
+	maxSweepInterval = time.Minute
+)
+
 type MetricService struct {
 	storage  MetricStorage
 	filepath string
+	hub      *Hub
+	// strict - принимать только метрики, описанные в реестре, с подходящими типом и значением.
+	strict bool
+	// done закрывается в Stop и останавливает фоновую очистку.
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 func NewMetricService(cfg *config.Config, storage MetricStorage) (*MetricService, error) {
-	ms := MetricService{
+	ms := &MetricService{
 		storage:  storage,
 		filepath: cfg.FileStoragePath,
+		hub:      NewHub(),
+		strict:   cfg.StrictMeta,
+		done:     make(chan struct{}),
 	}
 	if cfg.Restore {
 		err := ms.loadMetricsFromFile()
@@ -48,45 +80,175 @@ func NewMetricService(cfg *config.Config, storage MetricStorage) (*MetricService
 			}
 		}()
 	}
-	return &ms, nil
+	if cfg.EvictTTL > 0 {
+		ms.wg.Add(1)
+		go ms.sweep(sweepInterval(time.Duration(cfg.EvictTTL) * time.Second))
+	}
+	return ms, nil
+}
+
+// sweepInterval - как часто искать устаревшие метрики: в десять раз чаще срока удаления,
+// чтобы метрика не жила заметно дольше него, но не чаще раза в секунду.
+func sweepInterval(evict time.Duration) time.Duration {
+	return min(max(evict/10, minSweepInterval), maxSweepInterval)
+}
+
+func (ms *MetricService) sweep(interval time.Duration) {
+	defer ms.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ms.done:
+			return
+		case now := <-t.C:
+			ms.evictStale(now)
+		}
+	}
 }
 
-func (ms *MetricService) GetMetric(mType, mName string) (*domain.Metric, error) {
-	metric, err := ms.storage.GetMetric(mType, mName)
+// evictStale удаляет из хранилища gauge, которые не обновлялись дольше срока удаления.
+// В асинхронном режиме файлового хранилища удаление попадёт в снапшот при следующем сохранении.
+func (ms *MetricService) evictStale(now time.Time) {
+	evicted, err := ms.storage.EvictStale(now)
+	if err != nil {
+		logger.Log.Error("failed to evict stale metrics", zap.Error(err))
+	}
+	if evicted > 0 {
+		logger.Log.Info("stale metrics evicted", zap.Int("count", evicted))
+	}
+}
+
+// Stop останавливает фоновую очистку и ждёт её завершения. Повторные вызовы ничего не делают.
+func (ms *MetricService) Stop() {
+	ms.stopOnce.Do(func() {
+		close(ms.done)
+	})
+	ms.wg.Wait()
+}
+
+func (ms *MetricService) GetMetric(key domain.Key) (*domain.Metric, error) {
+	metric, err := ms.storage.GetMetric(key)
 	if err != nil {
 		return metric, fmt.Errorf("failed to get metric: %w", err)
 	}
 	return metric, nil
 }
 
+func (ms *MetricService) GetMetricDetails(key domain.Key) (*domain.MetricDetails, error) {
+	details, err := ms.storage.GetMetricDetails(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metric details: %w", err)
+	}
+	return details, nil
+}
+
 func (ms *MetricService) SetMetric(m *domain.Metric) (*domain.Metric, error) {
+	if err := validateMetric(m); err != nil {
+		return &domain.Metric{}, err
+	}
+	if err := ms.checkMeta(m); err != nil {
+		return &domain.Metric{}, err
+	}
+	metric, err := ms.storage.SetMetric(m)
+	if err != nil {
+		return metric, fmt.Errorf("%w", err)
+	}
+	ms.hub.Publish(*metric)
+	return metric, nil
+}
+
+func (ms *MetricService) SetMetrics(metrics domain.MetricsList) (domain.MetricsList, error) {
+	if len(metrics) == 0 {
+		return nil, domain.ErrEmptyBatch
+	}
+	for i := range metrics {
+		if err := validateMetric(&metrics[i]); err != nil {
+			return nil, fmt.Errorf("metric %q: %w", metrics[i].ID, err)
+		}
+		if err := ms.checkMeta(&metrics[i]); err != nil {
+			return nil, err
+		}
+	}
+	result, err := ms.storage.SetMetrics(metrics)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	ms.hub.Publish(result...)
+	return result, nil
+}
+
+func validateMetric(m *domain.Metric) error {
+	if err := m.Labels.Validate(); err != nil {
+		return err
+	}
 	switch m.MType {
-	case domain.Gauge, domain.Counter:
-		metric, err := ms.storage.SetMetric(m)
-		if err != nil {
-			return metric, fmt.Errorf("%w", err)
+	case domain.Gauge:
+		if m.Value == nil {
+			return domain.ErrIncorrectMetricValue
+		}
+	case domain.Counter:
+		if m.Delta == nil {
+			return domain.ErrIncorrectMetricValue
+		}
+	case domain.Histogram:
+		if m.Value == nil && (m.Histogram == nil || len(m.Histogram.Counts) == 0) {
+			return domain.ErrIncorrectMetricValue
+		}
+		if m.Value != nil && (math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0)) {
+			return domain.ErrIncorrectMetricValue
+		}
+		if m.Histogram != nil {
+			if err := m.Histogram.Validate(); err != nil {
+				return err
+			}
+		}
+	case domain.Summary:
+		if m.Value == nil && (m.Summary == nil || m.Summary.Count == 0) {
+			return domain.ErrIncorrectMetricValue
+		}
+		if m.Value != nil && (math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0)) {
+			return domain.ErrIncorrectMetricValue
+		}
+		if m.Summary != nil {
+			if err := m.Summary.Validate(); err != nil {
+				return err
+			}
 		}
-		return metric, nil
 	default:
-		return &domain.Metric{}, domain.ErrIncorrectMetricType
+		return domain.ErrIncorrectMetricType
 	}
+	return nil
 }
 
 func (ms *MetricService) SetMetricValue(req *domain.SetMetricRequest) (*domain.Metric, error) {
+	if err := req.Labels.Validate(); err != nil {
+		return &domain.Metric{}, err
+	}
 	switch req.MType {
-	case domain.Gauge:
+	case domain.Gauge, domain.Histogram, domain.Summary:
 		value, err := strconv.ParseFloat(req.Value, 64)
 		if err != nil {
 			return &domain.Metric{}, domain.ErrIncorrectMetricValue
 		}
-		metric, err := ms.storage.SetMetric(&domain.Metric{
-			ID:    req.ID,
-			MType: req.MType,
-			Value: &value,
-		})
+		m := &domain.Metric{
+			ID:     req.ID,
+			MType:  req.MType,
+			Value:  &value,
+			Labels: req.Labels,
+			Source: req.Source,
+		}
+		if err = validateMetric(m); err != nil {
+			return &domain.Metric{}, err
+		}
+		if err = ms.checkMeta(m); err != nil {
+			return &domain.Metric{}, err
+		}
+		metric, err := ms.storage.SetMetric(m)
 		if err != nil {
 			return metric, fmt.Errorf("%w", err)
 		}
+		ms.hub.Publish(*metric)
 		return metric, nil
 	case domain.Counter:
 		value, err := strconv.Atoi(req.Value)
@@ -94,26 +256,90 @@ func (ms *MetricService) SetMetricValue(req *domain.SetMetricRequest) (*domain.M
 			return &domain.Metric{}, domain.ErrIncorrectMetricValue
 		}
 		valueInt := int64(value)
-		metric, err := ms.storage.SetMetric(&domain.Metric{
-			ID:    req.ID,
-			MType: req.MType,
-			Delta: &valueInt,
-		})
+		m := &domain.Metric{
+			ID:     req.ID,
+			MType:  req.MType,
+			Delta:  &valueInt,
+			Labels: req.Labels,
+			Source: req.Source,
+		}
+		if err = ms.checkMeta(m); err != nil {
+			return &domain.Metric{}, err
+		}
+		metric, err := ms.storage.SetMetric(m)
 		if err != nil {
 			return metric, fmt.Errorf("%w", err)
 		}
+		ms.hub.Publish(*metric)
 		return metric, nil
 	default:
 		return &domain.Metric{}, domain.ErrIncorrectMetricType
 	}
 }
 
-func (ms *MetricService) GetMetricValue(mType, mName string) (string, error) {
-	metric, err := ms.storage.GetMetric(mType, mName)
+// checkMeta в строгом режиме сверяет метрику с реестром. Без строгого режима реестр только описывает метрики.
+func (ms *MetricService) checkMeta(m *domain.Metric) error {
+	if !ms.strict {
+		return nil
+	}
+	meta, err := ms.storage.GetMeta(m.ID)
+	if errors.Is(err, domain.ErrItemNotFound) {
+		return fmt.Errorf("%w: %q", domain.ErrUnregisteredMetric, m.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+	if err = meta.Check(m); err != nil {
+		return err
+	}
+	if m.Relative {
+		m.Registered = meta
+	}
+	return nil
+}
+
+// GetAgents возвращает известных агентов по источникам последних записей метрик.
+func (ms *MetricService) GetAgents() ([]domain.Agent, error) {
+	metrics, err := ms.storage.GetAllMetrics()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
+	}
+	return domain.CollectAgents(metrics), nil
+}
+
+// SetMeta регистрирует или заменяет описание метрики.
+func (ms *MetricService) SetMeta(meta *domain.Meta) error {
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+	if err := ms.storage.SetMeta(meta); err != nil {
+		return fmt.Errorf("failed to set metadata: %w", err)
+	}
+	return nil
+}
+
+func (ms *MetricService) GetMeta(name string) (*domain.Meta, error) {
+	meta, err := ms.storage.GetMeta(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	return meta, nil
+}
+
+func (ms *MetricService) GetAllMeta() (domain.Registry, error) {
+	registry, err := ms.storage.GetAllMeta()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	return registry, nil
+}
+
+func (ms *MetricService) GetMetricValue(key domain.Key) (string, error) {
+	metric, err := ms.storage.GetMetric(key)
 	if err != nil {
 		return "", fmt.Errorf("%w", err)
 	}
-	switch mType {
+	switch key.MType {
 	case domain.Gauge:
 		value := strconv.FormatFloat(*metric.Value, 'f', -1, 64)
 		return value, nil
@@ -133,16 +359,134 @@ func (ms *MetricService) GetAllMetrics() (domain.MetricsList, error) {
 	return metrics, nil
 }
 
+func (ms *MetricService) QueryMetrics(q *domain.MetricQuery) (domain.MetricPage, error) {
+	page, err := ms.storage.QueryMetrics(q)
+	if err != nil {
+		return domain.MetricPage{}, fmt.Errorf("%w", err)
+	}
+	return page, nil
+}
+
+func (ms *MetricService) DeleteMetric(key domain.Key) error {
+	if err := ms.storage.DeleteMetric(key); err != nil {
+		return fmt.Errorf("failed to delete metric: %w", err)
+	}
+	return nil
+}
+
+func (ms *MetricService) DeleteMetrics(q *domain.MetricQuery) (int, error) {
+	deleted, err := ms.storage.DeleteMetrics(q)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete metrics: %w", err)
+	}
+	return deleted, nil
+}
+
+func (ms *MetricService) ResetCounter(key domain.Key) (*domain.Metric, error) {
+	if key.MType != domain.Counter {
+		return &domain.Metric{}, domain.ErrIncorrectMetricType
+	}
+	metric, err := ms.storage.ResetCounter(key)
+	if err != nil {
+		return metric, fmt.Errorf("failed to reset counter: %w", err)
+	}
+	ms.hub.Publish(*metric)
+	return metric, nil
+}
+
+// Quantiles оценивает квантили qs по скетчу метрики типа summary.
+func (ms *MetricService) Quantiles(key domain.Key, qs []float64) (*domain.QuantileResult, error) {
+	if key.MType != domain.Summary {
+		return nil, domain.ErrIncorrectMetricType
+	}
+	metric, err := ms.storage.GetMetric(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get summary: %w", err)
+	}
+	result := &domain.QuantileResult{
+		ID:        metric.ID,
+		Labels:    metric.Labels,
+		Count:     metric.Summary.Count,
+		Sum:       metric.Summary.Sum,
+		Quantiles: make([]domain.Quantile, 0, len(qs)),
+	}
+	for _, q := range qs {
+		value, err := metric.Summary.Quantile(q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate quantile %v: %w", q, err)
+		}
+		result.Quantiles = append(result.Quantiles, domain.Quantile{Quantile: q, Value: value})
+	}
+	return result, nil
+}
+
+// Subscribe подписывает на изменения метрик, подходящих под filter.
+// Возвращает канал изменений и функцию отписки. Канал закрывается, если подписчик не успевает его читать.
+func (ms *MetricService) Subscribe(filter *domain.MetricQuery) (<-chan domain.Metric, func()) {
+	sub := ms.hub.Subscribe(filter)
+	return sub.C, func() {
+		ms.hub.Unsubscribe(sub)
+	}
+}
+
+func (ms *MetricService) Health() domain.Health {
+	health := domain.Health{
+		Status: domain.StatusOK,
+		Checks: []domain.HealthCheck{ms.storage.Health()},
+	}
+	for _, check := range health.Checks {
+		if check.Status != domain.StatusOK {
+			health.Status = domain.StatusError
+		}
+	}
+	return health
+}
+
+func (ms *MetricService) GetHistory(key domain.Key, from, to time.Time, step time.Duration) ([]domain.Sample, error) {
+	samples, err := ms.storage.GetHistory(key, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+	return domain.Downsample(samples, step), nil
+}
+
+// Aggregate считает функцию fn по значениям метрики за последние window.
+func (ms *MetricService) Aggregate(key domain.Key, fn domain.Aggregation, window time.Duration) (*domain.AggregateResult, error) {
+	if window <= 0 {
+		return nil, domain.ErrIncorrectWindow
+	}
+	if fn.CounterOnly() && key.MType != domain.Counter {
+		return nil, domain.ErrNotCounter
+	}
+	if fn.GaugeOnly() && key.MType != domain.Gauge {
+		return nil, domain.ErrNotGauge
+	}
+	// История берётся целиком, чтобы increase и rate начинались от последнего значения до окна.
+	history, err := ms.storage.GetHistory(key, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history for aggregation: %w", err)
+	}
+	base, samples := domain.SplitWindow(history, time.Now().Add(-window))
+	value, err := domain.Aggregate(fn, base, samples, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate %s: %w", fn, err)
+	}
+	return &domain.AggregateResult{
+		ID:      key.ID,
+		MType:   key.MType,
+		Fn:      fn,
+		Window:  window.String(),
+		Value:   value,
+		Samples: len(samples),
+	}, nil
+}
+
 func (ms *MetricService) SaveMetricsToFile() error {
-	metricValues := make(domain.MetricValues)
-	metrics, err := ms.storage.GetAllMetrics()
+	metricValues, registry, err := ms.storage.Snapshot()
 	if err != nil {
 		return fmt.Errorf("failed to get metrics for saving to file: %w", err)
 	}
-	for _, v := range metrics {
-		metricValues[domain.Key{ID: v.ID, MType: v.MType}] = domain.Value{Value: v.Value, Delta: v.Delta}
-	}
-	err = files.SaveMetricsToFile(ms.filepath, metricValues)
+	err = files.SaveMetricsToFile(ms.filepath, metricValues, registry)
 	if err != nil {
 		return fmt.Errorf("failed to save metrics to file: %w", err)
 	}
@@ -150,20 +494,12 @@ func (ms *MetricService) SaveMetricsToFile() error {
 }
 
 func (ms *MetricService) loadMetricsFromFile() error {
-	metrics, err := files.LoadMetricsFromFile(ms.filepath)
+	metrics, registry, err := files.LoadMetricsFromFile(ms.filepath)
 	if err != nil {
 		return fmt.Errorf("failed to load metrics for restore: %w", err)
 	}
-	for k, v := range metrics {
-		_, err := ms.storage.SetMetric(&domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to save metrics in restore: %w", err)
-		}
+	if err = ms.storage.Restore(metrics, registry); err != nil {
+		return fmt.Errorf("failed to save metrics in restore: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/server/adapters/storage/file"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/files"
+)
+
+func TestMetricService_Staleness(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	metricStorage, err := file.NewStorage(&file.Config{
+		Filepath: filePath,
+		Staleness: domain.Staleness{
+			TTL:   time.Minute,
+			Rules: []domain.TTLRule{{Pattern: "cpu.*", TTL: time.Hour}},
+			Evict: 2 * time.Hour,
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ms, err := NewMetricService(&config.Config{FileStoragePath: filePath, EvictTTL: 7200}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ms.Stop()
+
+	now := time.Now()
+	value, delta := 1.0, int64(1)
+	assert.NoError(t, metricStorage.Restore(domain.MetricValues{
+		{MType: domain.Gauge, ID: "fresh"}:    {Value: &value, Updated: now},
+		{MType: domain.Gauge, ID: "mem"}:      {Value: &value, Updated: now.Add(-10 * time.Minute)},
+		{MType: domain.Gauge, ID: "cpu.load"}: {Value: &value, Updated: now.Add(-10 * time.Minute)},
+		{MType: domain.Gauge, ID: "dead"}:     {Value: &value, Updated: now.Add(-3 * time.Hour)},
+		{MType: domain.Counter, ID: "hits"}:   {Delta: &delta, Updated: now.Add(-3 * time.Hour)},
+	}, nil))
+
+	tests := []struct {
+		name  string
+		key   domain.Key
+		stale bool
+	}{
+		{name: "fresh", key: domain.Key{MType: domain.Gauge, ID: "fresh"}},
+		{name: "defaultTTL", key: domain.Key{MType: domain.Gauge, ID: "mem"}, stale: true},
+		{name: "patternTTL", key: domain.Key{MType: domain.Gauge, ID: "cpu.load"}},
+		{name: "counter", key: domain.Key{MType: domain.Counter, ID: "hits"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, err := ms.GetMetric(tt.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.stale, metric.Stale)
+		})
+	}
+
+	ms.evictStale(now)
+	_, err = ms.GetMetric(domain.Key{MType: domain.Gauge, ID: "dead"})
+	assert.ErrorIs(t, err, domain.ErrItemNotFound)
+	restored, _, err := files.LoadMetricsFromFile(filePath)
+	assert.NoError(t, err)
+	assert.Len(t, restored, 4)
+	assert.NotContains(t, restored, domain.Key{MType: domain.Gauge, ID: "dead"})
+}
+
+// В строгом режиме диапазон относительного gauge проверяется по итоговому значению, а не по приращению.
+func TestMetricService_StrictRelativeGauge(t *testing.T) {
+	metricStorage, err := memory.NewStorage(&memory.Config{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ms, err := NewMetricService(&config.Config{StrictMeta: true}, metricStorage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ms.Stop()
+	low, high := 0.0, 100.0
+	assert.NoError(t, ms.SetMeta(&domain.Meta{Name: "queue", MType: domain.Gauge, Min: &low, Max: &high}))
+	key := domain.Key{MType: domain.Gauge, ID: "queue"}
+	add := func(v float64) error {
+		_, err := ms.SetMetric(&domain.Metric{ID: "queue", MType: domain.Gauge, Value: &v, Relative: true})
+		return err
+	}
+
+	assert.NoError(t, add(60))
+	assert.ErrorIs(t, add(60), domain.ErrValueOutOfRange)
+	value, err := ms.GetMetricValue(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "60", value)
+
+	assert.ErrorIs(t, add(-70), domain.ErrValueOutOfRange)
+	assert.NoError(t, add(-60))
+	value, err = ms.GetMetricValue(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "0", value)
+}
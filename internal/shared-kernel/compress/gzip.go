@@ -27,6 +27,18 @@ func (c *Writer) Write(p []byte) (int, error) {
 	return n, nil
 }
 
+// Flush отправляет клиенту уже сжатые данные, не завершая gzip-поток.
+func (c *Writer) Flush() {
+	if err := c.zw.Flush(); err != nil {
+		return
+	}
+	_ = http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+func (c *Writer) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
 func (c *Writer) Close() error {
 	err := c.zw.Close()
 	if err != nil {
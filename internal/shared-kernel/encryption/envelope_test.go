@@ -0,0 +1,31 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	data := []byte(`[{"id":"Alloc","type":"gauge","value":1.5}]`)
+
+	envelope, err := Seal(&key.PublicKey, data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(envelope), "Alloc")
+
+	opened, err := Open(key, envelope)
+	require.NoError(t, err)
+	assert.Equal(t, data, opened)
+
+	envelope[len(envelope)-1] ^= 0xff
+	_, err = Open(key, envelope)
+	assert.Error(t, err)
+
+	_, err = Open(key, envelope[:1])
+	assert.ErrorIs(t, err, ErrMalformedEnvelope)
+}
@@ -0,0 +1,50 @@
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	Header = "HashSHA256"
+	// MetadataKey - ключ метаданных gRPC с подписью запроса.
+	MetadataKey = "hashsha256"
+)
+
+func Sign(key string, data []byte) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func Verify(key string, data []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hmac.Equal(h.Sum(nil), expected)
+}
+
+// SignMessage подписывает детерминированную сериализацию proto-сообщения,
+// чтобы клиент и сервер подписывали одни и те же байты.
+func SignMessage(key string, m proto.Message) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return Sign(key, data), nil
+}
+
+func VerifyMessage(key string, m proto.Message, signature string) bool {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return false
+	}
+	return Verify(key, data, signature)
+}